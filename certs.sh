@@ -0,0 +1,48 @@
+#!/bin/bash
+# Generates test certificates for running the broker over TLS, in peril_certs:
+# a CA, a certificate for the broker, and client certificates whose common
+# name is the broker username they log in as with --broker-auth external.
+# They are for local testing only; the keys are not protected.
+
+set -e
+
+dir=peril_certs
+days=365
+
+client() {
+    name=$1
+    openssl req -new -newkey rsa:2048 -nodes -subj "/CN=$name" \
+        -keyout "$dir/$name.key" -out "$dir/$name.csr" 2>/dev/null
+    openssl x509 -req -in "$dir/$name.csr" -CA "$dir/ca.pem" -CAkey "$dir/ca.key" -CAcreateserial \
+        -days $days -extfile <(printf "extendedKeyUsage=clientAuth") -out "$dir/$name.pem" 2>/dev/null
+    rm "$dir/$name.csr"
+    echo "Wrote $dir/$name.pem and $dir/$name.key"
+}
+
+case "$1" in
+    init)
+        mkdir -p "$dir"
+        openssl req -x509 -new -newkey rsa:2048 -nodes -subj "/CN=Peril test CA" -days $days \
+            -keyout "$dir/ca.key" -out "$dir/ca.pem" 2>/dev/null
+        openssl req -new -newkey rsa:2048 -nodes -subj "/CN=localhost" \
+            -keyout "$dir/server.key" -out "$dir/server.csr" 2>/dev/null
+        openssl x509 -req -in "$dir/server.csr" -CA "$dir/ca.pem" -CAkey "$dir/ca.key" -CAcreateserial \
+            -days $days -extfile <(printf "subjectAltName=DNS:localhost,IP:127.0.0.1\nextendedKeyUsage=serverAuth") \
+            -out "$dir/server.pem" 2>/dev/null
+        rm "$dir/server.csr"
+        # The broker runs as its own user inside the container.
+        chmod 644 "$dir/server.key"
+        echo "Wrote $dir/ca.pem and the broker's $dir/server.pem"
+        client peril-server
+        ;;
+    client)
+        if [ -z "$2" ]; then
+            echo "Usage: $0 client <username>"
+            exit 1
+        fi
+        client "$2"
+        ;;
+    *)
+        echo "Usage: $0 {init|client <username>}"
+        exit 1
+esac
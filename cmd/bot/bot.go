@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/player"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// bot is a computer player, playing through the same player package as the
+// client.
+type bot struct {
+	name     string
+	p        *player.Player
+	strategy gamelogic.Strategy
+	done     chan struct{}
+	finish   *sync.Once
+}
+
+func newBot(conn *amqp.Connection, name string, strategy gamelogic.Strategy) (*bot, error) {
+	p, err := player.New(conn, name)
+	if err != nil {
+		return nil, err
+	}
+	return &bot{
+		name:     name,
+		p:        p,
+		strategy: strategy,
+		done:     make(chan struct{}),
+		finish:   &sync.Once{},
+	}, nil
+}
+
+func (b *bot) stop() {
+	b.finish.Do(func() { close(b.done) })
+}
+
+func (b *bot) subscribe() error {
+	return b.p.Subscribe(player.Handlers{
+		Move: func(move gamelogic.ArmyMove, outcome gamelogic.MoveOutcome) {
+			if outcome != gamelogic.MoveOutcomeSamePlayer {
+				b.strategy.Observe(move.Player)
+			}
+		},
+		War: func(rw gamelogic.RecognitionOfWar, outcome gamelogic.WarOutcome, winner, loser string) {
+			switch outcome {
+			case gamelogic.WarOutcomeYouWon, gamelogic.WarOutcomeOpponentWon:
+				log.Printf("%s: %s won a war against %s", b.name, winner, loser)
+			case gamelogic.WarOutcomeDraw:
+				log.Printf("%s: a war between %s and %s resulted in a draw", b.name, winner, loser)
+			default:
+				return
+			}
+			b.strategy.Observe(rw.Defender)
+		},
+		GameOver: func(gameOver routing.GameOver) {
+			log.Printf("%s: game over, winner %q", b.name, gameOver.Winner)
+			b.stop()
+		},
+		Admin: func(m routing.Moderation) {
+			log.Printf("%s: removed by an admin: %s", b.name, m.Reason)
+			b.stop()
+		},
+	})
+}
+
+// run asks the strategy for a command every interval until the game ends.
+func (b *bot) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+		words := b.strategy.Next(b.p.GameState())
+		if words == nil {
+			continue
+		}
+		err := b.execute(words)
+		if err != nil {
+			log.Printf("%s: %v: %v", b.name, words, err)
+		}
+	}
+}
+
+func (b *bot) execute(words []string) error {
+	switch words[0] {
+	case "spawn", "move":
+		return b.p.Execute(words)
+	}
+	return fmt.Errorf("bots can not %s", words[0])
+}
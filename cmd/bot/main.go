@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func main() {
+	count := flag.Int("count", 1, "how many bots to run")
+	name := flag.String("name", "bot", "bot usernames are this followed by a number")
+	password := flag.String("password", "", "password the bots log in (and register) with")
+	strategies := flag.String("strategy", "random", fmt.Sprintf("comma separated strategies handed out in turn, from %v", gamelogic.StrategyNames()))
+	gameID := flag.String("game", "", "join this game")
+	create := flag.String("create", "", "create a game with this name for the bots to join")
+	interval := flag.Duration("interval", 2*time.Second, "how often each bot acts")
+	seed := flag.Int64("seed", 0, "random seed (0 picks one)")
+	verbose := flag.Bool("verbose", false, "show the game output of every bot")
+	cfg, args, err := config.Load(flag.CommandLine, os.Args[1:], "broker", "exchanges", "queues")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if ok, err := cfg.RunCommand(args, os.Stdout); ok {
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		return
+	}
+	cfg.Apply()
+	amqpConfig, err := cfg.Broker.AMQP()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if *password == "" || (*gameID == "" && *create == "") {
+		fmt.Println("bot needs --password and --game or --create")
+		os.Exit(2)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	names := strings.Split(*strategies, ",")
+
+	conn, err := amqp.DialConfig(cfg.Broker.URL, amqpConfig)
+	if err != nil {
+		log.Printf("Error connecting to amqp: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The game logic reports as if a player were watching. Bots log instead.
+	var presenter gamelogic.Presenter = gamelogic.SilentPresenter{}
+	if *verbose {
+		presenter = gamelogic.ConsolePresenter{}
+	}
+
+	bots := []*bot{}
+	for i := range *count {
+		botName := fmt.Sprintf("%s%d", *name, i+1)
+		strategy, err := gamelogic.NewStrategy(names[i%len(names)], rand.New(rand.NewSource(*seed+int64(i))))
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := startBot(conn, botName, *password, strategy, presenter, *gameID, *create)
+		if err != nil {
+			log.Printf("Error starting %s: %v", botName, err)
+			break
+		}
+		log.Printf("%s: playing %s in game %s", botName, strategy.Name(), b.p.GameID())
+		bots = append(bots, b)
+		// The first bot creates the game, the rest join it.
+		*gameID, *create = b.p.GameID(), ""
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		for _, b := range bots {
+			b.stop()
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for _, b := range bots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.run(*interval)
+			b.p.Leave()
+		}()
+	}
+	wg.Wait()
+}
+
+func startBot(conn *amqp.Connection, name, password string, strategy gamelogic.Strategy, presenter gamelogic.Presenter, gameID, create string) (*bot, error) {
+	key, err := auth.LoadOrCreateKey(filepath.Join("peril_keys", name+".key"))
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBot(conn, name, strategy)
+	if err != nil {
+		return nil, err
+	}
+	b.p.GameState().SetPresenter(presenter)
+	_, err = b.p.Login(password, "", key)
+	if err != nil {
+		return nil, err
+	}
+	err = b.p.SubscribeLobby()
+	if err != nil {
+		return nil, err
+	}
+	err = b.p.Join(gameID, create)
+	if err != nil {
+		return nil, err
+	}
+	return b, b.subscribe()
+}
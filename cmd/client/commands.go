@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/player"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
+)
+
+var errQuit = errors.New("quit")
+
+// client holds what the player's commands need once they are in a game.
+type client struct {
+	p      *player.Player
+	gs     *gamelogic.GameState
+	online *presence.Table
+}
+
+// execute runs one command. It returns errQuit when the player quits.
+func (c *client) execute(words []string) error {
+	err := c.p.Execute(words)
+	if err != player.ErrUnknownCommand {
+		return err
+	}
+	switch words[0] {
+	case "players":
+		c.gs.Present(gamelogic.PlayersOnline{Entries: c.online.List()})
+		return nil
+
+	case "help":
+		c.gs.Present(gamelogic.ClientHelp{})
+		return nil
+
+	case "spam":
+		if len(words) <= 1 {
+			return errors.New("usage: spam <count>")
+		}
+		spamQuantity, err := strconv.Atoi(words[1])
+		if err != nil {
+			return fmt.Errorf("spam needs an integer count, not %q", words[1])
+		}
+		for range spamQuantity {
+			err := c.p.PublishGameLog(gamelogic.GetMaliciousLog())
+			if err != nil {
+				return fmt.Errorf("could not publish spam game log: %v", err)
+			}
+		}
+		return nil
+
+	case "quit":
+		c.gs.Present(gamelogic.Quit{})
+		return errQuit
+
+	default:
+		return fmt.Errorf("unknown command %s, type help for the list", words[0])
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/player"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type lobbyOptions struct {
+	spectate bool
+	// gameID or create pick the game up front instead of prompting.
+	gameID string
+	create string
+}
+
+// chooseGame lists, creates and joins games through the server's lobby until
+// the player is in one. Spectators can only watch games.
+func chooseGame(p *player.Player, opts lobbyOptions) error {
+	spectate := opts.spectate
+	err := p.SubscribeLobby()
+	if err != nil {
+		return err
+	}
+
+	if opts.gameID != "" || opts.create != "" {
+		req := routing.LobbyRequest{Action: routing.LobbyJoin, GameID: opts.gameID}
+		switch {
+		case opts.create != "" && spectate:
+			return errors.New("spectators can only watch games")
+		case opts.create != "":
+			req = routing.LobbyRequest{Action: routing.LobbyCreate, Name: opts.create}
+		case spectate:
+			req.Action = routing.LobbyWatch
+		}
+		resp, err := p.LobbyRequest(req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Joined game %s\n", resp.GameID)
+		return nil
+	}
+
+	resp, err := p.LobbyRequest(routing.LobbyRequest{Action: routing.LobbyList})
+	if err != nil {
+		return err
+	}
+	gamelogic.PrintGames(resp.Games)
+	gamelogic.PrintLobbyHelp(spectate)
+
+	for {
+		words := gamelogic.GetInput()
+		if words == nil {
+			return errors.New("you must choose a game. goodbye")
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		if spectate && (words[0] == "create" || words[0] == "join") {
+			fmt.Println("spectators can only watch games")
+			continue
+		}
+
+		req := routing.LobbyRequest{}
+		switch words[0] {
+		case "list":
+			req.Action = routing.LobbyList
+		case "create":
+			req.Action = routing.LobbyCreate
+			req.Name = strings.Join(words[1:], " ")
+		case "join":
+			if len(words) < 2 {
+				fmt.Println("usage: join <gameID>")
+				continue
+			}
+			req.Action = routing.LobbyJoin
+			req.GameID = words[1]
+		case "watch":
+			if !spectate || len(words) < 2 {
+				fmt.Println("usage: watch <gameID> (with --spectate)")
+				continue
+			}
+			req.Action = routing.LobbyWatch
+			req.GameID = words[1]
+		case "quit":
+			return errors.New("goodbye")
+		default:
+			gamelogic.PrintLobbyHelp(spectate)
+			continue
+		}
+
+		resp, err := p.LobbyRequest(req)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if resp.GameID == "" {
+			gamelogic.PrintGames(resp.Games)
+			continue
+		}
+		if spectate {
+			fmt.Printf("Watching game %s\n", resp.GameID)
+		} else {
+			fmt.Printf("Joined game %s\n", resp.GameID)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/player"
+)
+
+// login authenticates with the server using a previous session token, or a
+// password (prompting for one if needed).
+func login(p *player.Player, password, token string, key ed25519.PrivateKey) error {
+	if token == "" && password == "" {
+		fmt.Println("Please enter your password (new usernames are registered with it):")
+		words := gamelogic.GetInput()
+		if len(words) == 0 {
+			return errors.New("you must enter a password. goodbye")
+		}
+		password = strings.Join(words, " ")
+	}
+
+	resp, err := p.Login(password, token, key)
+	if err != nil {
+		return err
+	}
+	if resp.Registered {
+		fmt.Printf("Registered new player %s\n", p.Username())
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+)
+
+// metricsPresenter counts the spawns, moves and wars a player's game shows,
+// then hands each event on.
+type metricsPresenter struct {
+	next gamelogic.Presenter
+}
+
+func (p metricsPresenter) Present(e gamelogic.Event) {
+	switch e := e.(type) {
+	case gamelogic.UnitSpawned:
+		metrics.Spawns.Inc()
+	case gamelogic.UnitsMoved:
+		metrics.Moves.Inc()
+	case gamelogic.WarResolved:
+		switch e.Outcome {
+		case gamelogic.WarOutcomeYouWon:
+			metrics.Wars.WithLabelValues("won").Inc()
+		case gamelogic.WarOutcomeOpponentWon:
+			metrics.Wars.WithLabelValues("lost").Inc()
+		case gamelogic.WarOutcomeDraw:
+			metrics.Wars.WithLabelValues("draw").Inc()
+		}
+	}
+	p.next.Present(e)
+}
+
+// playerUnits reports this player's units for peril_units.
+func playerUnits(gameID string, gs *gamelogic.GameState) func() []metrics.PlayerUnits {
+	return func() []metrics.PlayerUnits {
+		p := gs.GetPlayerSnap()
+		return []metrics.PlayerUnits{{GameID: gameID, Player: p.Username, Units: len(p.Units)}}
+	}
+}
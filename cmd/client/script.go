@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultExpectTimeout = 10 * time.Second
+
+// event is something a subscription handler saw, for scripts to expect.
+type event struct {
+	Name   string
+	Detail string
+	Time   time.Time
+}
+
+// eventLog records handler events while a script runs. A nil log records
+// nothing, so interactive players don't keep every event in memory.
+type eventLog struct {
+	events  []event
+	cursor  int
+	changed chan struct{}
+	mu      *sync.Mutex
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{
+		changed: make(chan struct{}),
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (l *eventLog) record(name, detail string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event{Name: name, Detail: detail, Time: time.Now()})
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// wait returns the first matching event since the last one waited for.
+func (l *eventLog) wait(name string, timeout time.Duration) (event, error) {
+	deadline := time.After(timeout)
+	for {
+		l.mu.Lock()
+		for i := l.cursor; i < len(l.events); i++ {
+			if l.events[i].Name == name {
+				l.cursor = i + 1
+				l.mu.Unlock()
+				return l.events[i], nil
+			}
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return event{}, fmt.Errorf("no %s event within %v", name, timeout)
+		}
+	}
+}
+
+// scriptLine is one command or directive, numbered from 1.
+type scriptLine struct {
+	Number int
+	Words  []string
+}
+
+// readScript reads commands one per line from a file, or separated by
+// semicolons from --exec. Blank lines and # comments are skipped.
+func readScript(path, exec string) ([]scriptLine, error) {
+	var r io.Reader = strings.NewReader(strings.ReplaceAll(exec, ";", "\n"))
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open script: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	lines := []scriptLine{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, scriptLine{Number: n, Words: strings.Fields(line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read script: %v", err)
+	}
+	return lines, nil
+}
+
+type scriptResult struct {
+	Line    int    `json:"line"`
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Event   string `json:"event,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// scriptStart is written first, so a test can start more players in the game.
+type scriptStart struct {
+	User string `json:"user"`
+	Game string `json:"game"`
+}
+
+type scriptSummary struct {
+	Done   bool `json:"done"`
+	Passed int  `json:"passed"`
+	Failed int  `json:"failed"`
+}
+
+// runScript runs the lines in order, writing one JSON result per line to out,
+// and stops at the first failure. Besides the client commands it understands
+//
+//	wait <duration>
+//	expect <event> [timeout]
+//
+// where event is move, war, pause, resume, game-over, wipe, diplomacy or chat.
+func runScript(c *client, events *eventLog, lines []scriptLine, out io.Writer) bool {
+	enc := json.NewEncoder(out)
+	enc.Encode(scriptStart{User: c.p.Username(), Game: c.p.GameID()})
+	summary := scriptSummary{Done: true}
+	for _, line := range lines {
+		result := scriptResult{Line: line.Number, Command: strings.Join(line.Words, " ")}
+		err := runScriptLine(c, events, line.Words, &result)
+		stop := err == errQuit
+		if err != nil && !stop {
+			result.Error = err.Error()
+		} else {
+			result.OK = true
+			summary.Passed++
+		}
+		enc.Encode(result)
+		if !result.OK {
+			summary.Failed++
+			break
+		}
+		if stop {
+			break
+		}
+	}
+	enc.Encode(summary)
+	return summary.Failed == 0
+}
+
+func runScriptLine(c *client, events *eventLog, words []string, result *scriptResult) error {
+	switch words[0] {
+	case "wait":
+		if len(words) != 2 {
+			return fmt.Errorf("usage: wait <duration>")
+		}
+		d, err := time.ParseDuration(words[1])
+		if err != nil {
+			return err
+		}
+		time.Sleep(d)
+		return nil
+
+	case "expect":
+		if len(words) < 2 || len(words) > 3 {
+			return fmt.Errorf("usage: expect <event> [timeout]")
+		}
+		timeout := defaultExpectTimeout
+		if len(words) == 3 {
+			d, err := time.ParseDuration(words[2])
+			if err != nil {
+				return err
+			}
+			timeout = d
+		}
+		e, err := events.wait(words[1], timeout)
+		if err != nil {
+			return err
+		}
+		result.Event = e.Name
+		result.Detail = e.Detail
+		return nil
+	}
+	return c.execute(words)
+}
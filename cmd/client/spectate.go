@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// spectate follows a game on transient queues of its own, so watching never
+// takes messages away from the players, and never publishes anything.
+func spectate(conn *amqp.Connection, gameID, userName string, combineAllies bool, keys, server *pubsub.KeyRegistry, presenter gamelogic.Presenter) error {
+	idBytes := make([]byte, 4)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return err
+	}
+	queue := func(kind string) string {
+		return routing.GameKey(gameID, routing.SpectatePrefix, userName, hex.EncodeToString(idBytes), kind)
+	}
+	s := gamelogic.NewSpectator(gameID, combineAllies)
+	s.SetPresenter(presenter)
+
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilTopic, queue(routing.SpawnPrefix), routing.GameKey(gameID, routing.SpawnPrefix, "*"), 1, func(spawn gamelogic.Spawn) string {
+		defer fmt.Print("> ")
+		s.HandleSpawn(spawn)
+		return "Ack"
+	}, pubsub.WithVerifier(keys), pubsub.WithRelay(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilTopic, queue(routing.ArmyMovesPrefix), routing.GameKey(gameID, routing.ArmyMovesPrefix, "*"), 1, func(move gamelogic.ArmyMove) string {
+		defer fmt.Print("> ")
+		s.HandleMove(move)
+		return "Ack"
+	}, pubsub.WithVerifier(keys), pubsub.WithRelay(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilTopic, queue(routing.WarRecognitionsPrefix), routing.GameKey(gameID, routing.WarRecognitionsPrefix, "*"), 1, func(rw gamelogic.RecognitionOfWar) string {
+		defer fmt.Print("> ")
+		s.HandleWar(rw)
+		return "Ack"
+	}, pubsub.WithVerifier(keys), pubsub.WithRelay(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilTopic, queue(routing.DiplomacyPrefix), routing.GameKey(gameID, routing.DiplomacyPrefix, "*"), 1, func(dm gamelogic.DiplomacyMessage) string {
+		s.HandleDiplomacy(dm)
+		return "Ack"
+	}, pubsub.WithVerifier(keys), pubsub.WithRelay(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilTopic, queue(routing.WipePrefix), routing.GameKey(gameID, routing.WipePrefix, "*"), 1, func(w routing.Wipe) string {
+		defer fmt.Print("> ")
+		s.HandleWipe(w)
+		return "Ack"
+	}, pubsub.WithVerifier(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeGob(conn, routing.ExchangePerilTopic, queue(routing.GameLogSlug), routing.GameKey(gameID, routing.GameLogSlug, "*"), 1, func(gl routing.GameLog) string {
+		defer fmt.Print("> ")
+		s.HandleLog(gl)
+		return "Ack"
+	}, pubsub.WithVerifier(keys), pubsub.WithRelay(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilDirect, queue(routing.PauseKey), routing.GameKey(gameID, routing.PauseKey), 1, func(ps routing.PlayingState) string {
+		defer fmt.Print("> ")
+		s.HandlePause(ps)
+		return "Ack"
+	}, pubsub.WithVerifier(server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(conn, routing.ExchangePerilDirect, queue(routing.GameOverKey), routing.GameKey(gameID, routing.GameOverKey), 1, func(gameOver routing.GameOver) string {
+		defer fmt.Print("> ")
+		s.HandleGameOver(gameOver)
+		return "Ack"
+	}, pubsub.WithVerifier(server))
+	if err != nil {
+		return err
+	}
+
+	gamelogic.PrintSpectatorHelp()
+	for {
+		words := gamelogic.GetInput()
+		if words == nil {
+			// stdin is closed, so there is nothing left to read.
+			gamelogic.PrintQuit()
+			return nil
+		}
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "board":
+			s.PrintBoard()
+		case "help":
+			gamelogic.PrintSpectatorHelp()
+		case "quit":
+			gamelogic.PrintQuit()
+			return nil
+		case "spawn", "move", "propose-alliance", "propose-pact", "accept", "break-alliance", "say", "whisper", "ally-chat", "spam":
+			fmt.Printf("Spectators can not %s.\n", words[0])
+		default:
+			fmt.Println("Invalid command. Try again.")
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const tuiRefresh = 500 * time.Millisecond
+
+var clientCommands = []string{
+	"accept", "ally-chat", "break-alliance", "help", "move", "players", "propose-alliance",
+	"propose-pact", "quit", "say", "spam", "spawn", "status", "whisper",
+}
+
+// tui runs the client full screen. Game events and the replies to commands
+// arrive through Present, log output through Write, and the commands typed on
+// the input line are read with next.
+type tui struct {
+	app        *tview.Application
+	world      *tview.TextView
+	units      *tview.TextView
+	feed       *tview.TextView
+	status     *tview.TextView
+	input      *tview.InputField
+	gs         *gamelogic.GameState
+	gameID     string
+	players    func() []string
+	lines      chan string
+	done       chan struct{}
+	history    []string
+	historyPos int
+	closed     *sync.Once
+}
+
+// startTUI takes over the terminal until stop is called or the player presses
+// Ctrl-C, which quits the client like the quit command.
+func startTUI(gs *gamelogic.GameState, gameID string, players func() []string) *tui {
+	t := &tui{
+		app:     tview.NewApplication(),
+		world:   tview.NewTextView(),
+		units:   tview.NewTextView(),
+		feed:    tview.NewTextView().SetDynamicColors(true).SetScrollable(true).SetMaxLines(1000),
+		status:  tview.NewTextView(),
+		input:   tview.NewInputField().SetLabel("> "),
+		gs:      gs,
+		gameID:  gameID,
+		players: players,
+		lines:   make(chan string, 16),
+		done:    make(chan struct{}),
+		closed:  &sync.Once{},
+	}
+	t.world.SetBorder(true).SetTitle(" World ")
+	t.units.SetBorder(true).SetTitle(" Units ")
+	t.feed.SetBorder(true).SetTitle(" Events ")
+	t.status.SetTextColor(tcell.ColorBlack).SetBackgroundColor(tcell.ColorWhite)
+	t.input.SetFieldBackgroundColor(tcell.ColorDefault)
+	t.input.SetInputCapture(t.handleKey)
+	t.input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			t.submit()
+		}
+	})
+
+	side := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.world, len(gamelogic.Locations())+2, 0, false).
+		AddItem(t.units, 0, 1, false)
+	panes := tview.NewFlex().
+		AddItem(side, 36, 0, false).
+		AddItem(t.feed, 0, 1, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, false).
+		AddItem(t.status, 1, 0, false).
+		AddItem(t.input, 1, 0, true)
+	t.app.SetRoot(root, true).SetFocus(t.input)
+
+	log.SetOutput(t)
+	go t.refreshLoop()
+	go func() {
+		err := t.app.Run()
+		t.close()
+		if err != nil {
+			log.Printf("Error running terminal UI: %v", err)
+		}
+	}()
+	return t
+}
+
+func (t *tui) stop() {
+	t.app.Stop()
+	t.close()
+}
+
+// close ends the refresh loop, makes next return quit and gives log output
+// back to the terminal.
+func (t *tui) close() {
+	t.closed.Do(func() {
+		close(t.done)
+		log.SetOutput(os.Stderr)
+	})
+}
+
+// next waits for the player's next command, like gamelogic.GetInput.
+func (t *tui) next() []string {
+	select {
+	case line := <-t.lines:
+		return strings.Fields(line)
+	case <-t.done:
+		return []string{"quit"}
+	}
+}
+
+// Write adds log output to the feed.
+func (t *tui) Write(p []byte) (int, error) {
+	text := strings.TrimRight(string(p), "\n")
+	t.queue(func() {
+		fmt.Fprintln(t.feed, tview.Escape(text))
+	})
+	return len(p), nil
+}
+
+// Present adds a game event to the feed and redraws the panes it may change.
+func (t *tui) Present(e gamelogic.Event) {
+	t.queue(func() {
+		if titled, ok := e.(interface{ Title() string }); ok {
+			fmt.Fprintf(t.feed, "[::b]%s[::-]\n", tview.Escape(titled.Title()))
+		}
+		for _, line := range e.Lines() {
+			fmt.Fprintln(t.feed, tview.Escape(line))
+		}
+		t.refresh()
+	})
+}
+
+// queue runs f on the UI goroutine, unless the UI has already stopped.
+func (t *tui) queue(f func()) {
+	select {
+	case <-t.done:
+	default:
+		t.app.QueueUpdateDraw(f)
+	}
+}
+
+func (t *tui) refreshLoop() {
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.queue(t.refresh)
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *tui) refresh() {
+	player := t.gs.GetPlayerSnap()
+	counts := map[string]int{}
+	units := []gamelogic.Unit{}
+	for _, unit := range player.Units {
+		counts[string(unit.Location)]++
+		units = append(units, unit)
+	}
+
+	t.world.Clear()
+	for _, loc := range gamelogic.Locations() {
+		fmt.Fprintf(t.world, "%-12s %d unit(s)\n", loc, counts[loc])
+	}
+
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	t.units.Clear()
+	for _, unit := range units {
+		fmt.Fprintf(t.units, "#%-3d %-10s %s\n", unit.ID, unit.Rank, unit.Location)
+	}
+
+	state := t.gs.PauseStatus()
+	if state == "" {
+		state = "playing"
+	}
+	t.status.SetText(fmt.Sprintf(" %s | game %s | %d unit(s) | %s", player.Username, t.gameID, len(units), state))
+}
+
+func (t *tui) submit() {
+	line := strings.TrimSpace(t.input.GetText())
+	t.input.SetText("")
+	if line == "" {
+		return
+	}
+	t.history = append(t.history, line)
+	t.historyPos = len(t.history)
+	fmt.Fprintf(t.feed, "> %s\n", tview.Escape(line))
+	select {
+	case t.lines <- line:
+	case <-t.done:
+	}
+}
+
+func (t *tui) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyUp:
+		if t.historyPos > 0 {
+			t.historyPos--
+			t.input.SetText(t.history[t.historyPos])
+		}
+		return nil
+	case tcell.KeyDown:
+		if t.historyPos < len(t.history)-1 {
+			t.historyPos++
+			t.input.SetText(t.history[t.historyPos])
+		} else {
+			t.historyPos = len(t.history)
+			t.input.SetText("")
+		}
+		return nil
+	case tcell.KeyTab:
+		t.complete()
+		return nil
+	}
+	return event
+}
+
+// complete finishes the word being typed, listing the options in the feed
+// when there is more than one.
+func (t *tui) complete() {
+	text := t.input.GetText()
+	words := strings.Fields(text)
+	if len(words) == 0 || strings.HasSuffix(text, " ") {
+		words = append(words, "")
+	}
+	partial := words[len(words)-1]
+
+	matches := []string{}
+	for _, candidate := range t.candidates(words[0], len(words)-1) {
+		if strings.HasPrefix(candidate, partial) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	completion := matches[0]
+	if len(matches) > 1 {
+		for _, m := range matches[1:] {
+			for !strings.HasPrefix(m, completion) {
+				completion = completion[:len(completion)-1]
+			}
+		}
+		fmt.Fprintln(t.feed, tview.Escape(strings.Join(matches, "  ")))
+	} else {
+		completion += " "
+	}
+	t.input.SetText(text[:len(text)-len(partial)] + completion)
+}
+
+// candidates returns the possible values for the argument at position.
+func (t *tui) candidates(command string, position int) []string {
+	if position == 0 {
+		return clientCommands
+	}
+	switch command {
+	case "move":
+		if position == 1 {
+			return gamelogic.Locations()
+		}
+		ids := []string{}
+		for id := range t.gs.GetPlayerSnap().Units {
+			ids = append(ids, strconv.Itoa(id))
+		}
+		sort.Strings(ids)
+		return ids
+	case "spawn":
+		if position == 1 {
+			return gamelogic.Locations()
+		}
+		if position == 2 {
+			return gamelogic.Ranks()
+		}
+	case "propose-alliance", "propose-pact", "accept", "break-alliance", "whisper":
+		if position == 1 {
+			return t.players()
+		}
+	}
+	return nil
+}
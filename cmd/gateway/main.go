@@ -0,0 +1,256 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/player"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/gorilla/websocket"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+//go:embed web
+var web embed.FS
+
+// loginTimeout is how long a new socket has to send its login frame.
+const loginTimeout = 30 * time.Second
+
+// gateway lets browsers play over WebSocket, each as a player of its own.
+type gateway struct {
+	url        string
+	amqpConfig amqp.Config
+	// keysDir holds a private key per browser player, which the gateway
+	// signs that player's messages with, so whoever runs the gateway can
+	// play as any of them. The server pins it as the player's gateway key,
+	// next to the key the player's own client keeps, so playing in a browser
+	// never replaces that one.
+	keysDir       string
+	heartbeat     time.Duration
+	combineAllies bool
+	upgrader      websocket.Upgrader
+}
+
+func main() {
+	addr := flag.String("addr", ":8090", "serve the web client and WebSocket on this address")
+	keysDir := flag.String("keys-dir", "peril_keys", "directory holding the key the gateway signs with for each browser player")
+	heartbeat := flag.Duration("heartbeat", 10*time.Second, "how often players announce they are online")
+	cfg, args, err := config.Load(flag.CommandLine, os.Args[1:], "broker", "exchanges", "queues", "game.combine_allies")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if ok, err := cfg.RunCommand(args, os.Stdout); ok {
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		return
+	}
+	cfg.Apply()
+	amqpConfig, err := cfg.Broker.AMQP()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	g := &gateway{
+		url:           cfg.Broker.URL,
+		amqpConfig:    amqpConfig,
+		keysDir:       *keysDir,
+		heartbeat:     *heartbeat,
+		combineAllies: cfg.Game.CombineAllies,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+	}
+	static, err := fs.Sub(web, "web")
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("GET /ws", g.serveWS)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Gateway listening on %s", *addr)
+	err = srv.ListenAndServe()
+	if err != nil {
+		log.Fatalf("Error serving gateway: %v", err)
+	}
+}
+
+func (g *gateway) serveWS(w http.ResponseWriter, r *http.Request) {
+	// The upgrader has already answered with an error.
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	s := newSession(ws)
+	err = g.run(s)
+	if err != nil {
+		s.sendError(err)
+		if s.username != "" {
+			log.Printf("%s: %v", s.username, err)
+		}
+	}
+}
+
+// run plays one session: log in, pick a game in the lobby, then run commands
+// until the socket closes.
+func (g *gateway) run(s *session) error {
+	s.ws.SetReadDeadline(time.Now().Add(loginTimeout))
+	req, err := s.read()
+	if err != nil {
+		return err
+	}
+	s.ws.SetReadDeadline(time.Time{})
+	if req.Type != "login" {
+		return errors.New("log in first")
+	}
+	err = auth.ValidUsername(req.Username)
+	if err != nil {
+		return err
+	}
+	if req.Password == "" && req.Token == "" {
+		return errors.New("a password or session token is required")
+	}
+	s.username = req.Username
+
+	// Each session has its own connection, so closing it removes the
+	// player's exclusive queues.
+	s.conn, err = amqp.DialConfig(g.url, g.amqpConfig)
+	if err != nil {
+		log.Printf("Error connecting to amqp: %v", err)
+		return errors.New("the game is unavailable, try again later")
+	}
+	defer s.conn.Close()
+	s.p, err = player.New(s.conn, s.username)
+	if err != nil {
+		return err
+	}
+	s.p.UseGatewayKey()
+	gs := s.p.GameState()
+	gs.CombineAllies = g.combineAllies
+	gs.SetPresenter(gamelogic.NewJSONPresenter(s))
+
+	// The password is checked before the player's key file is touched.
+	_, err = s.p.Login(req.Password, req.Token, nil)
+	if err != nil {
+		return err
+	}
+	key, err := auth.LoadOrCreateKey(filepath.Join(g.keysDir, s.username+".key"))
+	if err != nil {
+		log.Printf("Error loading signing key: %v", err)
+		return errors.New("could not load your signing key")
+	}
+	resp, err := s.p.Login(req.Password, req.Token, key)
+	if err != nil {
+		return err
+	}
+	s.send("LoggedIn", map[string]string{"username": s.username, "token": resp.Token}, fmt.Sprintf("Logged in as %s", s.username))
+	log.Printf("%s: logged in", s.username)
+
+	err = s.p.SubscribeLobby()
+	if err != nil {
+		return err
+	}
+	err = g.lobby(s)
+	if err != nil {
+		return err
+	}
+
+	err = s.p.Subscribe(player.Handlers{
+		Admin: func(routing.Moderation) {
+			// Closing the socket ends the session like quitting the client.
+			s.ws.Close()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go s.p.Heartbeat(g.heartbeat, done)
+	defer s.p.Leave()
+	defer s.p.PublishPresence(routing.PresenceLeave)
+	defer close(done)
+	s.send("Joined", map[string]interface{}{
+		"game":      s.p.GameID(),
+		"locations": gamelogic.Locations(),
+		"ranks":     gamelogic.Ranks(),
+	}, fmt.Sprintf("Joined game %s", s.p.GameID()))
+	log.Printf("%s: joined game %s", s.username, s.p.GameID())
+
+	for {
+		req, err := s.read()
+		if err != nil {
+			// The browser went away.
+			return nil
+		}
+		if req.Type != "command" {
+			s.sendError(fmt.Errorf("can not %s while in a game", req.Type))
+			continue
+		}
+		err = s.execute(strings.Fields(req.Command))
+		if err != nil {
+			s.sendError(err)
+		}
+	}
+}
+
+// lobby lists games until the player joins or creates one.
+func (g *gateway) lobby(s *session) error {
+	list := func() {
+		resp, err := s.p.LobbyRequest(routing.LobbyRequest{Action: routing.LobbyList})
+		if err != nil {
+			s.sendError(err)
+			return
+		}
+		s.send("Games", resp.Games)
+	}
+	list()
+	for {
+		req, err := s.read()
+		if err != nil {
+			return err
+		}
+		var lobbyReq routing.LobbyRequest
+		switch req.Type {
+		case "list":
+			list()
+			continue
+		case "join":
+			lobbyReq = routing.LobbyRequest{Action: routing.LobbyJoin, GameID: req.Game}
+		case "create":
+			lobbyReq = routing.LobbyRequest{Action: routing.LobbyCreate, Name: req.Name}
+		default:
+			s.sendError(fmt.Errorf("can not %s in the lobby, list, join or create a game", req.Type))
+			continue
+		}
+		_, err = s.p.LobbyRequest(lobbyReq)
+		if err != nil {
+			s.sendError(err)
+			continue
+		}
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/player"
+	"github.com/gorilla/websocket"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// request is a frame from the browser. Type is login, list, join, create or
+// command, and says which of the other fields are used.
+type request struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+	Game     string `json:"game"`
+	Name     string `json:"name"`
+	Command  string `json:"command"`
+}
+
+// frame is sent to the browser. Game events come from the JSON presenter in
+// the same shape, so the page handles both alike.
+type frame struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Lines []string    `json:"lines"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// session is one browser playing through the gateway, with a broker
+// connection of its own.
+type session struct {
+	ws       *websocket.Conn
+	writing  *sync.Mutex
+	conn     *amqp.Connection
+	p        *player.Player
+	username string
+}
+
+func newSession(ws *websocket.Conn) *session {
+	return &session{
+		ws:      ws,
+		writing: &sync.Mutex{},
+	}
+}
+
+// Write sends one JSON presenter line as a text frame.
+func (s *session) Write(p []byte) (int, error) {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+	err := s.ws.WriteMessage(websocket.TextMessage, []byte(strings.TrimSpace(string(p))))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *session) send(event string, data interface{}, lines ...string) {
+	if lines == nil {
+		lines = []string{}
+	}
+	out, err := json.Marshal(frame{Event: event, Time: time.Now(), Lines: lines, Data: data})
+	if err != nil {
+		log.Printf("Error encoding %s frame: %v", event, err)
+		return
+	}
+	_, err = s.Write(out)
+	if err != nil {
+		log.Printf("Error sending %s frame to %s: %v", event, s.username, err)
+	}
+}
+
+func (s *session) sendError(err error) {
+	s.send("Error", nil, err.Error())
+}
+
+func (s *session) read() (request, error) {
+	var req request
+	err := s.ws.ReadJSON(&req)
+	return req, err
+}
+
+// execute runs one command typed in the page.
+func (s *session) execute(words []string) error {
+	err := s.p.Execute(words)
+	if err == player.ErrUnknownCommand {
+		return fmt.Errorf("unknown command %s, the web client can spawn, move, show status, make alliances and chat", words[0])
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+// A minimal Peril client. Every frame from the gateway is an event with a
+// name, lines of text and optional data; game events are the same ones the
+// terminal client prints.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+let ws = null;
+let loggedIn = false;
+
+function show(section) {
+  for (const id of ["login", "lobby", "game"]) {
+    $(id).hidden = id !== section;
+  }
+}
+
+function log(event) {
+  const events = $("events");
+  if (event.title) {
+    const title = document.createElement("div");
+    title.className = "title";
+    title.textContent = "==== " + event.title + " ====";
+    events.appendChild(title);
+  }
+  for (const line of event.lines || []) {
+    const div = document.createElement("div");
+    div.className = event.event;
+    div.textContent = line;
+    events.appendChild(div);
+  }
+  events.scrollTop = events.scrollHeight;
+}
+
+function send(frame) {
+  ws.send(JSON.stringify(frame));
+}
+
+function fillSelect(select, options) {
+  select.replaceChildren(...options.map((o) => new Option(o, o)));
+}
+
+function showGames(games) {
+  const list = $("games");
+  list.replaceChildren();
+  if (!games || games.length === 0) {
+    list.textContent = "No games yet, create one.";
+    return;
+  }
+  for (const game of games) {
+    if (game.Over) {
+      continue;
+    }
+    const li = document.createElement("li");
+    const players = (game.Players || []).join(", ") || "no players";
+    li.textContent = `${game.Name} (${game.ID}): ${players}${game.Paused ? ", paused" : ""} `;
+    const join = document.createElement("button");
+    join.textContent = "Join";
+    join.onclick = () => send({ type: "join", game: game.ID });
+    li.appendChild(join);
+    list.appendChild(li);
+  }
+}
+
+function handle(event) {
+  switch (event.event) {
+    case "LoggedIn":
+      loggedIn = true;
+      sessionStorage.setItem("peril", JSON.stringify(event.data));
+      show("lobby");
+      break;
+    case "Games":
+      showGames(event.data);
+      break;
+    case "Joined":
+      $("game-title").textContent = "Game " + event.data.game;
+      for (const form of ["spawn-form", "move-form"]) {
+        fillSelect($(form).location, event.data.locations);
+      }
+      fillSelect($("spawn-form").rank, event.data.ranks);
+      show("game");
+      break;
+    case "Error":
+      // A stale session token is dropped so the next login asks again.
+      if (!loggedIn) {
+        sessionStorage.removeItem("peril");
+      }
+      break;
+  }
+  log(event);
+}
+
+function connect(login) {
+  const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+  ws = new WebSocket(`${scheme}//${location.host}/ws`);
+  loggedIn = false;
+  ws.onopen = () => send(login);
+  ws.onmessage = (msg) => handle(JSON.parse(msg.data));
+  ws.onclose = () => {
+    log({ event: "Error", lines: ["Disconnected"] });
+    show("login");
+  };
+}
+
+$("login-form").onsubmit = (e) => {
+  e.preventDefault();
+  const form = e.target;
+  const login = { type: "login", username: form.username.value, password: form.password.value };
+  const saved = JSON.parse(sessionStorage.getItem("peril") || "null");
+  if (!login.password && saved && saved.username === login.username) {
+    login.token = saved.token;
+  }
+  form.password.value = "";
+  connect(login);
+};
+
+$("refresh").onclick = () => send({ type: "list" });
+
+$("create-form").onsubmit = (e) => {
+  e.preventDefault();
+  send({ type: "create", name: e.target.gamename.value });
+};
+
+$("spawn-form").onsubmit = (e) => {
+  e.preventDefault();
+  send({ type: "command", command: `spawn ${e.target.location.value} ${e.target.rank.value}` });
+};
+
+$("move-form").onsubmit = (e) => {
+  e.preventDefault();
+  send({ type: "command", command: `move ${e.target.location.value} ${e.target.units.value}` });
+};
+
+$("command-form").onsubmit = (e) => {
+  e.preventDefault();
+  send({ type: "command", command: e.target.command.value });
+  e.target.command.value = "";
+};
+
+const saved = JSON.parse(sessionStorage.getItem("peril") || "null");
+if (saved) {
+  $("login-form").username.value = saved.username;
+}
+show("login");
@@ -0,0 +1,246 @@
+// logbench measures how many game logs per second the server's log pipeline
+// stores. By default it feeds the batching writer directly; with --broker the
+// logs go through RabbitMQ and SubscribeGobBatch first, as on the server.
+// The storage alone has go test benchmarks, run with
+// go test -bench . ./internal/logstore.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logstore"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func main() {
+	rate := flag.Int("rate", 10000, "game logs offered per second")
+	duration := flag.Duration("duration", 10*time.Second, "how long to offer logs for")
+	batch := flag.Int("batch", 100, "game logs written together (1 writes each on its own)")
+	flush := flag.Duration("flush", 500*time.Millisecond, "longest a log waits for its batch to fill")
+	dir := flag.String("dir", "", "directory for the database and text log (default a temporary one)")
+	textLog := flag.Bool("text", true, "also write the rotating text log, like the server")
+	broker := flag.Bool("broker", false, "publish the logs through RabbitMQ")
+	cfg, args, err := config.Load(flag.CommandLine, os.Args[1:], "broker", "exchanges", "queues")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ok, err := cfg.RunCommand(args, os.Stdout); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	cfg.Apply()
+
+	if *dir == "" {
+		tmp, err := os.MkdirTemp("", "logbench")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		*dir = tmp
+	}
+	db, err := logstore.Open(filepath.Join(*dir, "game_logs.db"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	sinks := []logstore.Sink{db}
+	if *textLog {
+		logFile, err := logstore.OpenRotating(logstore.RotateConfig{
+			Path:       filepath.Join(*dir, "game.log"),
+			MaxSize:    10 << 20,
+			MaxBackups: 3,
+			Compress:   true,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer logFile.Close()
+		sinks = append(sinks, logFile)
+	}
+	writer := logstore.NewWriter(*batch, *flush, sinks...)
+	defer writer.Close()
+
+	s := newStats()
+	store := func(logs []routing.GameLog) string {
+		entries := []logstore.Entry{}
+		for _, gl := range logs {
+			entries = append(entries, logstore.FromGameLog(gl, logstore.EventGame))
+		}
+		err := writer.Write(entries)
+		if err != nil {
+			log.Printf("Error writing %d game log(s): %v", len(entries), err)
+			return "NackRequeue"
+		}
+		s.stored(logs)
+		return "Ack"
+	}
+
+	var offer func(routing.GameLog)
+	if *broker {
+		offer, err = viaBroker(cfg.Broker, *batch, *flush, store)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		offer = direct(*batch, *flush, store)
+	}
+
+	fmt.Printf("Offering %d logs/s for %v in batches of up to %d...\n", *rate, *duration, *batch)
+	start := time.Now()
+	offered := generate(*rate, *duration, offer)
+	stopped := time.Now()
+	s.waitFor(offered, *duration+10*time.Second)
+	fmt.Println(s.report(offered, stopped.Sub(start), stopped))
+}
+
+// generate offers logs at the given rate, a millisecond's worth at a time.
+func generate(rate int, duration time.Duration, offer func(routing.GameLog)) int {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+	offered := 0
+	for now := range ticker.C {
+		elapsed := now.Sub(start)
+		if elapsed >= duration {
+			break
+		}
+		due := int(elapsed.Seconds() * float64(rate))
+		for ; offered < due; offered++ {
+			offer(routing.GameLog{
+				CurrentTime: time.Now(),
+				Username:    fmt.Sprintf("bench%d", offered%10),
+				Message:     fmt.Sprintf("benchmark log %d", offered),
+				GameID:      "bench",
+			})
+		}
+	}
+	return offered
+}
+
+// direct batches logs in process the way SubscribeGobBatch does.
+func direct(batchSize int, maxWait time.Duration, store func([]routing.GameLog) string) func(routing.GameLog) {
+	logs := make(chan routing.GameLog, batchSize*10)
+	go func() {
+		batch := []routing.GameLog{}
+		timer := time.NewTimer(maxWait)
+		timer.Stop()
+		for {
+			select {
+			case gl := <-logs:
+				if len(batch) == 0 {
+					timer.Reset(maxWait)
+				}
+				batch = append(batch, gl)
+				if len(batch) < batchSize {
+					continue
+				}
+				timer.Stop()
+			case <-timer.C:
+			}
+			if len(batch) > 0 {
+				store(batch)
+				batch = []routing.GameLog{}
+			}
+		}
+	}()
+	return func(gl routing.GameLog) {
+		logs <- gl
+	}
+}
+
+func viaBroker(broker config.Broker, batchSize int, maxWait time.Duration, store func([]routing.GameLog) string) (func(routing.GameLog), error) {
+	amqpConfig, err := broker.AMQP()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := amqp.DialConfig(broker.URL, amqpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to RabbitMQ: %v", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	idBytes := make([]byte, 4)
+	_, err = rand.Read(idBytes)
+	if err != nil {
+		return nil, err
+	}
+	key := "logbench." + hex.EncodeToString(idBytes)
+	err = pubsub.SubscribeGobBatch(conn, routing.ExchangePerilTopic, key, key, 1, batchSize, maxWait, store)
+	if err != nil {
+		return nil, err
+	}
+	return func(gl routing.GameLog) {
+		err := pubsub.PublishGob(ch, routing.ExchangePerilTopic, key, gl)
+		if err != nil {
+			log.Printf("Error publishing: %v", err)
+		}
+	}, nil
+}
+
+// stats records how long each log took from being offered to being stored.
+type stats struct {
+	latencies  []time.Duration
+	lastStored time.Time
+	mu         *sync.Mutex
+}
+
+func newStats() *stats {
+	return &stats{mu: &sync.Mutex{}}
+}
+
+func (s *stats) stored(logs []routing.GameLog) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastStored = now
+	for _, gl := range logs {
+		s.latencies = append(s.latencies, now.Sub(gl.CurrentTime))
+	}
+}
+
+func (s *stats) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.latencies)
+}
+
+func (s *stats) waitFor(n int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for s.count() < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// report gives the rate over the time logs were being offered, and how long
+// the last of them took to be stored once offering stopped.
+func (s *stats) report(offered int, offering time.Duration, stopped time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.latencies) == 0 {
+		return fmt.Sprintf("Offered %d logs, stored none", offered)
+	}
+	sorted := append([]time.Duration{}, s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))].Round(time.Microsecond)
+	}
+	return fmt.Sprintf("Stored %d of %d logs, %.0f logs/s over %v, the last %v after offering stopped; latency p50 %v, p99 %v, max %v",
+		len(sorted), offered, float64(len(sorted))/offering.Seconds(), offering.Round(time.Millisecond),
+		s.lastStored.Sub(stopped).Round(time.Millisecond), percentile(0.5), percentile(0.99), sorted[len(sorted)-1].Round(time.Microsecond))
+}
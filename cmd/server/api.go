@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logstore"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// adminAPI serves the admin commands over HTTP as JSON. Every endpoint but
+// /healthz needs "Authorization: Bearer <token>".
+type adminAPI struct {
+	token   string
+	conn    *amqp.Connection
+	games   *lobby
+	online  *presence.Table
+	logDB   *logstore.DB
+	mod     *moderator
+	started time.Time
+}
+
+func (a *adminAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", a.health)
+	mux.Handle("GET /api/games", a.authorized(a.listGames))
+	mux.Handle("GET /api/players", a.authorized(a.listPlayers))
+	mux.Handle("POST /api/pause", a.authorized(a.pause(true)))
+	mux.Handle("POST /api/resume", a.authorized(a.pause(false)))
+	mux.Handle("GET /api/logs", a.authorized(a.logs))
+	mux.Handle("GET /api/dlq", a.authorized(a.deadLetters))
+	return mux
+}
+
+// serve runs the API until the server exits.
+func (a *adminAPI) serve(addr string) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           a.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Admin API listening on %s", addr)
+	err := srv.ListenAndServe()
+	if err != nil {
+		log.Printf("Error serving admin API: %v", err)
+	}
+}
+
+func (a *adminAPI) authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(a.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong admin token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Error writing admin API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	AMQP    bool   `json:"amqp"`
+	Uptime  string `json:"uptime"`
+	Games   int    `json:"games"`
+	Players int    `json:"players"`
+}
+
+// health reports 503 once the broker connection is lost, so a container
+// runtime can restart the server.
+func (a *adminAPI) health(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{
+		Status:  "ok",
+		AMQP:    !a.conn.IsClosed(),
+		Uptime:  time.Since(a.started).Round(time.Second).String(),
+		Games:   len(a.games.list()),
+		Players: len(a.online.List()),
+	}
+	status := http.StatusOK
+	if !resp.AMQP {
+		resp.Status = "amqp disconnected"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+func (a *adminAPI) listGames(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.games.list())
+}
+
+func (a *adminAPI) listPlayers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.online.List())
+}
+
+type pauseRequest struct {
+	// Game is empty for every game.
+	Game string `json:"game"`
+	// Scope is "", "player" or "region", with Target naming which.
+	Scope    string `json:"scope"`
+	Target   string `json:"target"`
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// pause publishes the same PlayingState as the pause and resume commands.
+func (a *adminAPI) pause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req pauseRequest
+		if r.ContentLength != 0 {
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("could not parse request: %v", err))
+				return
+			}
+		}
+		ps, err := req.playingState(paused)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = a.games.publishPause(req.Game, ps)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		action := "resume"
+		if paused {
+			action = "pause"
+		}
+		a.mod.audit(strings.Join(strings.Fields(fmt.Sprintf("%s %s %s %s via admin API %s", action, req.Game, ps.Scope, ps.Target, ps.Reason)), " "))
+		writeJSON(w, http.StatusOK, ps)
+	}
+}
+
+func (req pauseRequest) playingState(paused bool) (routing.PlayingState, error) {
+	ps := routing.PlayingState{
+		IsPaused: paused,
+		Scope:    routing.PauseScope(req.Scope),
+		Target:   req.Target,
+		Reason:   req.Reason,
+	}
+	switch ps.Scope {
+	case routing.PauseGlobal:
+	case routing.PausePlayer, routing.PauseRegion:
+		if ps.Target == "" {
+			return ps, fmt.Errorf("a %s pause needs a target", ps.Scope)
+		}
+		if ps.Scope == routing.PauseRegion && !gamelogic.IsValidLocation(ps.Target) {
+			return ps, fmt.Errorf("%s is not a valid location", ps.Target)
+		}
+	default:
+		return ps, fmt.Errorf("unknown pause scope %q", req.Scope)
+	}
+	if paused && req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return ps, fmt.Errorf("%q is not a positive duration", req.Duration)
+		}
+		ps.Duration = d
+	}
+	return ps, nil
+}
+
+// logs takes at most one of search, by or since, and n to change how many
+// entries come back.
+func (a *adminAPI) logs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	n := logsLimit
+	if q.Has("n") {
+		parsed, err := strconv.Atoi(q.Get("n"))
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%q is not a number of entries", q.Get("n")))
+			return
+		}
+		n = parsed
+	}
+
+	var entries []logstore.Entry
+	var err error
+	switch {
+	case q.Has("search"):
+		entries, err = a.logDB.Search(q.Get("search"), n)
+	case q.Has("by"):
+		entries, err = a.logDB.By(q.Get("by"), n)
+	case q.Has("since"):
+		var since time.Time
+		since, err = parseSince(q.Get("since"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		entries, err = a.logDB.Since(since, n)
+	default:
+		entries, err = a.logDB.Tail(n)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+type deadLetter struct {
+	RoutingKey  string     `json:"routing_key"`
+	Reason      string     `json:"reason,omitempty"`
+	ContentType string     `json:"content_type"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Headers     amqp.Table `json:"headers,omitempty"`
+	// JSON bodies are shown as they are, anything else base64 encoded.
+	JSON json.RawMessage `json:"json,omitempty"`
+	Body []byte          `json:"body,omitempty"`
+}
+
+type deadLettersResponse struct {
+	Count    int          `json:"count"`
+	Messages []deadLetter `json:"messages"`
+}
+
+// deadLetters peeks at the oldest messages in the dead letter queue. They are
+// never acked, so closing the channel puts them back.
+func (a *adminAPI) deadLetters(w http.ResponseWriter, r *http.Request) {
+	n := logsLimit
+	if s := r.URL.Query().Get("n"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%q is not a number of messages", s))
+			return
+		}
+		n = parsed
+	}
+	ch, err := a.conn.Channel()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer ch.Close()
+	queue, err := ch.QueueDeclarePassive(pubsub.DeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	resp := deadLettersResponse{Count: queue.Messages, Messages: []deadLetter{}}
+	for range min(n, queue.Messages) {
+		delivery, ok, err := ch.Get(pubsub.DeadLetterQueue, false)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if !ok {
+			break
+		}
+		dl := deadLetter{
+			RoutingKey:  delivery.RoutingKey,
+			ContentType: delivery.ContentType,
+			Timestamp:   delivery.Timestamp,
+			Headers:     delivery.Headers,
+		}
+		if original, ok := delivery.Headers["x-original-routing-key"].(string); ok {
+			dl.RoutingKey = original
+		}
+		if reason, ok := delivery.Headers[pubsub.RejectReasonHeader].(string); ok {
+			dl.Reason = reason
+		}
+		if delivery.ContentType == "application/json" && json.Valid(delivery.Body) {
+			dl.JSON = delivery.Body
+		} else {
+			dl.Body = delivery.Body
+		}
+		resp.Messages = append(resp.Messages, dl)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const refereeQueueSuffix = "referee"
+
+type game struct {
+	info    routing.GameInfo
+	referee *gamelogic.Referee
+}
+
+// pauseTimer identifies what a timed pause paused, so a newer pause or
+// resume of the same thing can cancel its automatic resume.
+type pauseTimer struct {
+	gameID string
+	scope  routing.PauseScope
+	target string
+}
+
+type lobby struct {
+	conn          *amqp.Connection
+	ch            *amqp.Channel
+	conditions    gamelogic.VictoryConditions
+	combineAllies bool
+	keys          *pubsub.KeyRegistry
+	// sign signs what the lobby announces as the server, and server verifies
+	// that signature.
+	sign   pubsub.PublishOption
+	server *pubsub.KeyRegistry
+	games  map[string]*game
+	timers map[pauseTimer]*time.Timer
+	// standingsFile is where finished games' standings are appended, or ""
+	// to not keep them.
+	standingsFile string
+	// resume is called when a timed pause runs out. It is publishPause,
+	// except in tests.
+	resume func(gameID string, ps routing.PlayingState) error
+	mu     *sync.Mutex
+}
+
+func newLobby(conn *amqp.Connection, ch *amqp.Channel, conditions gamelogic.VictoryConditions, combineAllies bool, keys *pubsub.KeyRegistry, sign pubsub.PublishOption, server *pubsub.KeyRegistry) *lobby {
+	l := &lobby{
+		conn:          conn,
+		ch:            ch,
+		conditions:    conditions,
+		combineAllies: combineAllies,
+		keys:          keys,
+		sign:          sign,
+		server:        server,
+		games:         map[string]*game{},
+		timers:        map[pauseTimer]*time.Timer{},
+		mu:            &sync.Mutex{},
+	}
+	l.resume = l.publishPause
+	return l
+}
+
+func (l *lobby) handleRequest(req routing.LobbyRequest) string {
+	resp := routing.LobbyResponse{Action: req.Action}
+	switch req.Action {
+	case routing.LobbyList:
+	case routing.LobbyCreate:
+		g, err := l.createGame(req.Name)
+		if err != nil {
+			log.Printf("Error creating game: %v", err)
+			resp.Error = "the server could not create the game"
+			break
+		}
+		resp.GameID = g.ID
+		err = l.join(g.ID, req.Username)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	case routing.LobbyJoin:
+		resp.GameID = req.GameID
+		err := l.join(req.GameID, req.Username)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	case routing.LobbyLeave:
+		l.leave(req.GameID, req.Username)
+	case routing.LobbyWatch:
+		if _, ok := l.getGame(req.GameID); !ok {
+			resp.Error = fmt.Sprintf("no game with ID %s", req.GameID)
+			break
+		}
+		resp.GameID = req.GameID
+	default:
+		resp.Error = fmt.Sprintf("unknown lobby action %q", req.Action)
+	}
+	resp.Games = l.list()
+
+	err := pubsub.PublishJSON(l.ch, routing.ExchangePerilDirect, fmt.Sprintf("%s.%s", routing.LobbyKey, req.Username), resp, l.sign)
+	if err != nil {
+		log.Printf("Error publishing lobby response: %v", err)
+		return "NackRequeue"
+	}
+	return "Ack"
+}
+
+func (l *lobby) createGame(name string) (routing.GameInfo, error) {
+	idBytes := make([]byte, 3)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return routing.GameInfo{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+	if name == "" {
+		name = id
+	}
+
+	referee := gamelogic.NewReferee(l.conditions)
+	referee.CombineAllies = l.combineAllies
+	referee.OnWar = metrics.ObserveWar
+	g := &game{
+		info: routing.GameInfo{
+			ID:        id,
+			Name:      name,
+			Players:   []string{},
+			CreatedAt: time.Now(),
+		},
+		referee: referee,
+	}
+	err = l.subscribeReferee(id, referee)
+	if err != nil {
+		return routing.GameInfo{}, err
+	}
+	if l.conditions.TimeLimit > 0 {
+		time.AfterFunc(l.conditions.TimeLimit, func() {
+			defer fmt.Print("> ")
+			if gameOver, ok := referee.TimeUp(); ok {
+				l.announceGameOver(id, gameOver)
+			}
+		})
+	}
+
+	l.mu.Lock()
+	l.games[id] = g
+	l.mu.Unlock()
+	fmt.Printf("Created game %s (%s)\n", id, name)
+	return g.info, nil
+}
+
+func (l *lobby) join(gameID, username string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g, ok := l.games[gameID]
+	if !ok {
+		return fmt.Errorf("no game with ID %s", gameID)
+	}
+	if g.info.Over {
+		return fmt.Errorf("game %s is over", gameID)
+	}
+	if !slices.Contains(g.info.Players, username) {
+		g.info.Players = append(g.info.Players, username)
+	}
+	return nil
+}
+
+func (l *lobby) leave(gameID, username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g, ok := l.games[gameID]
+	if !ok {
+		return
+	}
+	g.info.Players = slices.DeleteFunc(g.info.Players, func(p string) bool { return p == username })
+}
+
+func (l *lobby) list() []routing.GameInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	games := []routing.GameInfo{}
+	for _, g := range l.games {
+		info := g.info
+		info.Players = slices.Clone(g.info.Players)
+		games = append(games, info)
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].CreatedAt.Before(games[j].CreatedAt) })
+	return games
+}
+
+func (l *lobby) getGame(gameID string) (*game, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g, ok := l.games[gameID]
+	return g, ok
+}
+
+// publishPause sends a pause or resume to one game, or to every game when
+// gameID is empty. Player pauses only go to the games the player is in. Timed
+// pauses are resumed automatically unless another pause or resume of the same
+// game, player or region comes first.
+func (l *lobby) publishPause(gameID string, ps routing.PlayingState) error {
+	gameIDs := []string{}
+	for _, g := range l.list() {
+		if gameID != "" && g.ID != gameID {
+			continue
+		}
+		if ps.Scope == routing.PausePlayer && !slices.Contains(g.Players, ps.Target) {
+			continue
+		}
+		gameIDs = append(gameIDs, g.ID)
+	}
+	if gameID != "" && len(gameIDs) == 0 {
+		return fmt.Errorf("no game with ID %s", gameID)
+	}
+
+	for _, id := range gameIDs {
+		g, ok := l.getGame(id)
+		if !ok {
+			continue
+		}
+		if !ps.IsPaused && ps.Scope == routing.PauseGlobal && g.referee.IsOver() {
+			fmt.Printf("Game %s is over and can not be resumed.\n", id)
+			continue
+		}
+		err := pubsub.PublishJSON(l.ch, routing.ExchangePerilDirect, routing.GameKey(id, routing.PauseKey), ps, l.sign)
+		if err != nil {
+			return err
+		}
+		if ps.Scope == routing.PauseGlobal {
+			l.mu.Lock()
+			g.info.Paused = ps.IsPaused
+			l.mu.Unlock()
+		}
+		l.scheduleResume(id, ps)
+	}
+	return nil
+}
+
+// scheduleResume replaces any pending resume for what ps pauses or resumes,
+// and starts a new one if ps is a timed pause.
+func (l *lobby) scheduleResume(gameID string, ps routing.PlayingState) {
+	key := pauseTimer{gameID: gameID, scope: ps.Scope, target: ps.Target}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := l.timers[key]; ok {
+		t.Stop()
+		delete(l.timers, key)
+	}
+	if !ps.IsPaused || ps.Duration <= 0 {
+		return
+	}
+
+	resume := ps
+	resume.IsPaused = false
+	resume.Duration = 0
+	resume.Reason = "pause expired"
+	var t *time.Timer
+	t = time.AfterFunc(ps.Duration, func() {
+		// A timer that fired while being replaced is no longer current.
+		l.mu.Lock()
+		current := l.timers[key] == t
+		if current {
+			delete(l.timers, key)
+		}
+		l.mu.Unlock()
+		if !current {
+			return
+		}
+		err := l.resume(gameID, resume)
+		if err != nil {
+			log.Printf("Error resuming after timed pause: %v", err)
+		}
+	})
+	l.timers[key] = t
+}
+
+// wipe removes a player's units in every game they are in.
+func (l *lobby) wipe(target, region, reason string) (int, error) {
+	wiped := 0
+	for _, g := range l.list() {
+		if !slices.Contains(g.Players, target) {
+			continue
+		}
+		err := pubsub.PublishJSON(l.ch, routing.ExchangePerilTopic, routing.GameKey(g.ID, routing.WipePrefix, target), routing.Wipe{
+			Target: target,
+			Region: region,
+			Reason: reason,
+		}, l.sign)
+		if err != nil {
+			return wiped, err
+		}
+		wiped++
+	}
+	return wiped, nil
+}
+
+func (l *lobby) subscribeReferee(gameID string, referee *gamelogic.Referee) error {
+	err := pubsub.SubscribeJSON(l.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.SpawnPrefix, refereeQueueSuffix), routing.GameKey(gameID, routing.SpawnPrefix, "*"), 1, func(spawn gamelogic.Spawn) string {
+		referee.HandleSpawn(spawn)
+		return "Ack"
+	}, pubsub.WithVerifier(l.keys), pubsub.WithRelay(l.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(l.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.ArmyMovesPrefix, refereeQueueSuffix), routing.GameKey(gameID, routing.ArmyMovesPrefix, "*"), 1, func(move gamelogic.ArmyMove) string {
+		metrics.Moves.Inc()
+		if gameOver, ok := referee.HandleMove(move); ok {
+			defer fmt.Print("> ")
+			l.announceGameOver(gameID, gameOver)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(l.keys), pubsub.WithRelay(l.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(l.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.WarRecognitionsPrefix, refereeQueueSuffix), routing.GameKey(gameID, routing.WarRecognitionsPrefix, "*"), 1, func(rw gamelogic.RecognitionOfWar) string {
+		if gameOver, ok := referee.HandleWar(rw); ok {
+			defer fmt.Print("> ")
+			l.announceGameOver(gameID, gameOver)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(l.keys), pubsub.WithRelay(l.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(l.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.DiplomacyPrefix, refereeQueueSuffix), routing.GameKey(gameID, routing.DiplomacyPrefix, "*"), 1, func(dm gamelogic.DiplomacyMessage) string {
+		referee.HandleDiplomacy(dm)
+		return "Ack"
+	}, pubsub.WithVerifier(l.keys), pubsub.WithRelay(l.server))
+	if err != nil {
+		return err
+	}
+	return pubsub.SubscribeJSON(l.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.WipePrefix, refereeQueueSuffix), routing.GameKey(gameID, routing.WipePrefix, "*"), 1, func(w routing.Wipe) string {
+		referee.HandleWipe(w)
+		return "Ack"
+	}, pubsub.WithVerifier(l.server))
+}
+
+func (l *lobby) announceGameOver(gameID string, gameOver routing.GameOver) {
+	gameOver.GameID = gameID
+	l.mu.Lock()
+	if g, ok := l.games[gameID]; ok {
+		g.info.Over = true
+	}
+	l.mu.Unlock()
+
+	fmt.Println()
+	fmt.Printf("==== Game %s Over ====\n", gameID)
+	fmt.Println(gameOver.Reason)
+	gamelogic.PrintStandings(gameOver.Standings)
+	err := pubsub.PublishJSON(l.ch, routing.ExchangePerilDirect, routing.GameKey(gameID, routing.GameOverKey), gameOver, l.sign)
+	if err != nil {
+		log.Printf("Error publishing game over: %v", err)
+	}
+	if l.standingsFile == "" {
+		return
+	}
+	err = gamelogic.WriteStandings(l.standingsFile, gameOver)
+	if err != nil {
+		log.Printf("Error writing standings: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logstore"
+)
+
+// logsLimit is how many entries the logs command shows.
+const logsLimit = 20
+
+// queryLogs runs "logs tail [n]", "logs search <text>", "logs by <player>" or
+// "logs since <time|duration>".
+func queryLogs(db *logstore.DB, args []string) ([]logstore.Entry, error) {
+	if len(args) == 0 {
+		return nil, errors.New("usage: logs tail [n] | search <text> | by <player> | since <time|duration>")
+	}
+	switch strings.ToLower(args[0]) {
+	case "tail":
+		n := logsLimit
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("error: %s is not a number of entries", args[1])
+			}
+			n = parsed
+		}
+		return db.Tail(n)
+	case "search":
+		if len(args) < 2 {
+			return nil, errors.New("usage: logs search <text>")
+		}
+		return db.Search(strings.Join(args[1:], " "), logsLimit)
+	case "by":
+		if len(args) < 2 {
+			return nil, errors.New("usage: logs by <player>")
+		}
+		return db.By(args[1], logsLimit)
+	case "since":
+		if len(args) < 2 {
+			return nil, errors.New("usage: logs since <time|duration>")
+		}
+		since, err := parseSince(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return db.Since(since, logsLimit)
+	}
+	return nil, fmt.Errorf("error: unknown logs command %s", args[0])
+}
+
+// parseSince accepts an RFC 3339 time or a duration back from now, like 10m.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error: %s is neither a time like 2006-01-02T15:04:05Z nor a duration like 10m", s)
+	}
+	return t, nil
+}
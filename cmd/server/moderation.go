@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logstore"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/moderation"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const quarantineQueue = "peril_quarantine"
+
+const auditUsername = "admin"
+
+// moderator decides which relayed messages are quarantined instead of
+// delivered, and keeps every server's mute list in sync.
+type moderator struct {
+	ch    *amqp.Channel
+	logs  *moderation.Limiter
+	moves *moderation.Limiter
+	chat  *moderation.Limiter
+	spam  *moderation.SpamDetector
+	mutes *moderation.MuteList
+	bans  *moderation.BanList
+	// gameLogs records admin actions.
+	gameLogs *logstore.Writer
+	// sign signs actions as the server, and server verifies that signature.
+	sign   pubsub.PublishOption
+	server *pubsub.KeyRegistry
+}
+
+// subscribe declares the quarantine queue and listens for moderation actions
+// issued on any server.
+func (m *moderator) subscribe(conn *amqp.Connection) error {
+	_, _, err := pubsub.DeclareAndBind(conn, routing.ExchangePerilDirect, quarantineQueue, routing.QuarantineKey, 0)
+	if err != nil {
+		return err
+	}
+	queueName, err := serverQueueName(routing.ModerationPrefix)
+	if err != nil {
+		return err
+	}
+	return pubsub.SubscribeJSON(conn, routing.ExchangePerilTopic, queueName, fmt.Sprintf("%s.*", routing.ModerationPrefix), 1, m.handleAction, pubsub.WithVerifier(m.server))
+}
+
+func (m *moderator) handleAction(action routing.Moderation) string {
+	switch action.Action {
+	case routing.ModerationMute:
+		m.mutes.Mute(action.Target)
+	case routing.ModerationUnmute:
+		m.mutes.Unmute(action.Target)
+	case routing.ModerationBan:
+		err := m.bans.Ban(action.Target, action.Reason)
+		if err != nil {
+			log.Printf("Error saving ban: %v", err)
+		}
+	case routing.ModerationUnban:
+		err := m.bans.Unban(action.Target)
+		if err != nil {
+			log.Printf("Error saving ban: %v", err)
+		}
+	default:
+		return "NackDiscard"
+	}
+	return "Ack"
+}
+
+// announce tells every server, including this one, about an admin action.
+func (m *moderator) announce(action routing.ModerationAction, target, reason string) error {
+	return pubsub.PublishJSON(m.ch, routing.ExchangePerilTopic, fmt.Sprintf("%s.%s", routing.ModerationPrefix, action), routing.Moderation{
+		Action: action,
+		Target: target,
+		Reason: reason,
+		Time:   time.Now(),
+	}, m.sign)
+}
+
+// notify sends a kick or ban straight to the player's client, which disconnects.
+func (m *moderator) notify(action routing.ModerationAction, target, reason string) error {
+	return pubsub.PublishJSON(m.ch, routing.ExchangePerilDirect, fmt.Sprintf("%s.%s", routing.AdminPrefix, target), routing.Moderation{
+		Action: action,
+		Target: target,
+		Reason: reason,
+		Time:   time.Now(),
+	}, m.sign)
+}
+
+// audit records an admin action in the game log.
+func (m *moderator) audit(message string) {
+	m.gameLogs.Add(logstore.Entry{
+		Time:     time.Now(),
+		Username: auditUsername,
+		Message:  strings.TrimSpace(message),
+		Event:    logstore.EventAudit,
+	})
+}
+
+// check returns why a player's message should be quarantined, or "".
+func (m *moderator) check(username string, msg pubsub.Sender) string {
+	switch msg := msg.(type) {
+	case routing.GameLog:
+		if m.mutes.IsMuted(username) {
+			return "player is muted"
+		}
+		if !m.logs.Allow(username) {
+			return "game log rate limit exceeded"
+		}
+		return m.spam.Check(username, msg.Message)
+	case routing.ChatMessage:
+		if m.mutes.IsMuted(username) {
+			return "player is muted"
+		}
+		if !m.chat.Allow(username) {
+			return "chat rate limit exceeded"
+		}
+		return m.spam.Check(username, msg.Text)
+	case gamelogic.ArmyMove:
+		if !m.moves.Allow(username) {
+			return "move rate limit exceeded"
+		}
+	case gamelogic.Spawn:
+		// Spawns share the move limit, as both are game commands.
+		if !m.moves.Allow(username) {
+			return "spawn rate limit exceeded"
+		}
+	}
+	return ""
+}
+
+func (m *moderator) quarantine(delivery amqp.Delivery, username, reason string) error {
+	log.Printf("Quarantining %s from %s: %s", delivery.RoutingKey, username, reason)
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	delete(headers, routing.SessionHeader)
+	headers[routing.SenderHeader] = username
+	headers[routing.QuarantineReasonHeader] = reason
+	return m.ch.PublishWithContext(context.Background(), routing.ExchangePerilDirect, routing.QuarantineKey, false, false, amqp.Publishing{
+		ContentType:  delivery.ContentType,
+		Headers:      headers,
+		Body:         delivery.Body,
+		DeliveryMode: 2,
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// parsePause reads the arguments of the pause and resume commands:
+//
+//	pause [gameID] [duration] [reason]
+//	pause player <name> [duration] [reason]
+//	pause region <location> [duration] [reason]
+//
+// Quotes around the reason are optional.
+func parsePause(words []string, paused bool) (gameID string, ps routing.PlayingState, err error) {
+	ps.IsPaused = paused
+	args := words[1:]
+	if len(args) > 0 && (args[0] == string(routing.PausePlayer) || args[0] == string(routing.PauseRegion)) {
+		if len(args) < 2 {
+			return "", ps, fmt.Errorf("usage: %s %s <%s> [duration] [reason]", words[0], args[0], args[0])
+		}
+		ps.Scope = routing.PauseScope(args[0])
+		ps.Target = args[1]
+		if ps.Scope == routing.PauseRegion && !gamelogic.IsValidLocation(ps.Target) {
+			return "", ps, fmt.Errorf("error: %s is not a valid location", ps.Target)
+		}
+		args = args[2:]
+	} else if len(args) > 0 {
+		if _, err := time.ParseDuration(args[0]); err != nil {
+			gameID = args[0]
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 {
+		if d, err := time.ParseDuration(args[0]); err == nil {
+			if d <= 0 {
+				return "", ps, errors.New("the pause duration must be positive")
+			}
+			ps.Duration = d
+			args = args[1:]
+		}
+	}
+	ps.Reason = strings.Trim(strings.Join(args, " "), `"'`)
+	if !paused {
+		ps.Duration = 0
+	}
+	return gameID, ps, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func TestParsePause(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantGameID string
+		want       routing.PlayingState
+		wantErr    string
+	}{
+		{
+			input: "pause",
+			want:  routing.PlayingState{IsPaused: true},
+		},
+		{
+			input:      "pause a1b2 30s lunch",
+			wantGameID: "a1b2",
+			want:       routing.PlayingState{IsPaused: true, Duration: 30 * time.Second, Reason: "lunch"},
+		},
+		{
+			input: `pause player bob 60s "too many moves"`,
+			want:  routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob", Duration: time.Minute, Reason: "too many moves"},
+		},
+		{
+			input: `pause player bob 'afk'`,
+			want:  routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob", Reason: "afk"},
+		},
+		{
+			input: "pause region europe 5m storm",
+			want:  routing.PlayingState{IsPaused: true, Scope: routing.PauseRegion, Target: "europe", Duration: 5 * time.Minute, Reason: "storm"},
+		},
+		{
+			input:   "pause region atlantis",
+			wantErr: "atlantis is not a valid location",
+		},
+		{
+			input:   "pause player",
+			wantErr: "usage: pause player <player>",
+		},
+		{
+			input:   "pause player bob -5s",
+			wantErr: "must be positive",
+		},
+		{
+			input: "resume player bob 60s back",
+			want:  routing.PlayingState{Scope: routing.PausePlayer, Target: "bob", Reason: "back"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			words := strings.Fields(tc.input)
+			gameID, ps, err := parsePause(words, words[0] == "pause")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gameID != tc.wantGameID || ps != tc.want {
+				t.Errorf("got game %q %+v, expected game %q %+v", gameID, ps, tc.wantGameID, tc.want)
+			}
+		})
+	}
+}
+
+// resumes records the resumes a lobby publishes when timed pauses run out.
+type resumes struct {
+	got []routing.PlayingState
+	mu  *sync.Mutex
+}
+
+func testLobby() (*lobby, *resumes) {
+	r := &resumes{mu: &sync.Mutex{}}
+	l := newLobby(nil, nil, gamelogic.VictoryConditions{}, false, nil, nil, nil)
+	l.resume = func(gameID string, ps routing.PlayingState) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.got = append(r.got, ps)
+		return nil
+	}
+	return l, r
+}
+
+func (r *resumes) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.got)
+}
+
+func TestScheduleResume(t *testing.T) {
+	l, r := testLobby()
+	pause := routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob", Duration: 20 * time.Millisecond, Reason: "afk"}
+	l.scheduleResume("a1", pause)
+
+	time.Sleep(100 * time.Millisecond)
+	if r.count() != 1 {
+		t.Fatalf("expected one resume, got %d", r.count())
+	}
+	want := routing.PlayingState{Scope: routing.PausePlayer, Target: "bob", Reason: "pause expired"}
+	if r.got[0] != want {
+		t.Errorf("got %+v, expected %+v", r.got[0], want)
+	}
+}
+
+func TestScheduleResumeCancelled(t *testing.T) {
+	pause := routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob", Duration: 50 * time.Millisecond}
+	tests := []struct {
+		name string
+		next routing.PlayingState
+	}{
+		{
+			name: "resumed early",
+			next: routing.PlayingState{Scope: routing.PausePlayer, Target: "bob"},
+		},
+		{
+			name: "paused again without a duration",
+			next: routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob"},
+		},
+		{
+			name: "paused again for longer",
+			next: routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob", Duration: time.Hour},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l, r := testLobby()
+			l.scheduleResume("a1", pause)
+			l.scheduleResume("a1", tc.next)
+			time.Sleep(150 * time.Millisecond)
+			if r.count() != 0 {
+				t.Errorf("expected the first pause's resume to be cancelled, got %+v", r.got)
+			}
+		})
+	}
+}
+
+func TestScheduleResumeOtherTargets(t *testing.T) {
+	l, r := testLobby()
+	l.scheduleResume("a1", routing.PlayingState{IsPaused: true, Scope: routing.PausePlayer, Target: "bob", Duration: 20 * time.Millisecond})
+	// Resuming someone else, or bob in another game, leaves bob's resume be.
+	l.scheduleResume("a1", routing.PlayingState{Scope: routing.PausePlayer, Target: "carol"})
+	l.scheduleResume("b2", routing.PlayingState{Scope: routing.PausePlayer, Target: "bob"})
+	time.Sleep(100 * time.Millisecond)
+	if r.count() != 1 {
+		t.Errorf("expected bob's resume, got %d", r.count())
+	}
+}
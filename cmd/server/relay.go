@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logstore"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// relay checks that every message a client publishes under routing.InboundPrefix
+// was sent by the player it claims to come from, then republishes it to the
+// key the other players and the server listen on. They only accept what the
+// relay countersigned, see pubsub.WithRelay.
+type relay struct {
+	ch       *amqp.Channel
+	users    *auth.UserStore
+	keys     *auth.KeyStore
+	registry *pubsub.KeyRegistry
+	tokens   *auth.Tokens
+	mod      *moderator
+	gameLogs *logstore.Writer
+	// serverKey signs key announcements, so clients only trust keys the
+	// server registered, and countersigns what the relay republishes.
+	serverKey ed25519.PrivateKey
+}
+
+// handleLogin answers a login on the channel that sent it, through the
+// broker's direct reply-to, so the session token goes to nobody else.
+func (r *relay) handleLogin(delivery amqp.Delivery) string {
+	var req routing.LoginRequest
+	err := json.Unmarshal(delivery.Body, &req)
+	if err != nil {
+		log.Printf("Rejecting login: %v", err)
+		return "NackDiscard"
+	}
+	if !strings.HasPrefix(delivery.ReplyTo, pubsub.DirectReplyTo+".") {
+		log.Printf("Rejecting login for %s: bad reply-to %q", req.Username, delivery.ReplyTo)
+		return "NackDiscard"
+	}
+
+	resp := routing.LoginResponse{Username: req.Username}
+	passwordLogin := req.Token == ""
+	if r.mod.bans.IsBanned(req.Username) {
+		resp.Error = "you are banned from this server"
+	} else if passwordLogin {
+		registered, err := r.users.Authenticate(req.Username, req.Password)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		resp.Registered = registered
+	} else {
+		username, err := r.tokens.Verify(req.Token)
+		if err != nil || username != req.Username {
+			resp.Error = "your session has expired, log in with your password"
+		}
+	}
+	// A login without a key only checks who the player is, for the gateway,
+	// which loads its key for the player once it knows. The gateway's key is
+	// pinned apart from the player's own, so playing in a browser never
+	// replaces the key the player's client signs with.
+	if resp.Error == "" && len(req.PublicKey) > 0 {
+		signer := req.Username
+		if req.Gateway {
+			signer = routing.GatewaySigner(req.Username)
+		}
+		err := r.registerKey(signer, req.PublicKey, passwordLogin)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	if resp.Error == "" {
+		resp.Token = r.tokens.Issue(req.Username)
+		keys, err := r.keys.All()
+		if err != nil {
+			log.Printf("Error loading public keys: %v", err)
+		}
+		resp.PublicKeys = keys
+		resp.ServerKey = r.serverKey.Public().(ed25519.PublicKey)
+		log.Printf("%s logged in", req.Username)
+	}
+
+	err = pubsub.PublishJSON(r.ch, pubsub.DefaultExchange, delivery.ReplyTo, resp)
+	if err != nil {
+		// The reply-to only works while the player's channel is open, so a
+		// login can't be answered later.
+		log.Printf("Error publishing login response: %v", err)
+		return "NackDiscard"
+	}
+	return "Ack"
+}
+
+// registerKey pins a signer's key and announces it to the clients.
+func (r *relay) registerKey(signer string, key []byte, replace bool) error {
+	if len(key) == 0 {
+		return errors.New("a public key is required to sign your messages")
+	}
+	err := r.keys.Register(signer, key, replace)
+	if err != nil {
+		return err
+	}
+	r.registry.Add(signer, key)
+	return pubsub.PublishJSON(r.ch, routing.ExchangePerilTopic, fmt.Sprintf("%s.%s", routing.KeysPrefix, signer), routing.PlayerKey{
+		Username:  signer,
+		PublicKey: key,
+	}, pubsub.WithSignature(routing.ServerSigner, r.serverKey))
+}
+
+func (r *relay) handleInbound(ctx context.Context, delivery amqp.Delivery) string {
+	token, _ := delivery.Headers[routing.SessionHeader].(string)
+	username, err := r.tokens.Verify(token)
+	if err != nil {
+		log.Printf("Rejecting %s: %v", delivery.RoutingKey, err)
+		return "NackDiscard"
+	}
+
+	if r.mod.bans.IsBanned(username) {
+		log.Printf("Dropping %s from banned player %s", delivery.RoutingKey, username)
+		return "NackDiscard"
+	}
+
+	if signer, _ := delivery.Headers[pubsub.SignerHeader].(string); routing.SignerPlayer(signer) != username {
+		log.Printf("Rejecting %s: %s signed it as %q", delivery.RoutingKey, username, signer)
+		return "NackDiscard"
+	}
+
+	key := strings.TrimPrefix(delivery.RoutingKey, routing.InboundPrefix+".")
+	exchange, msg, err := decodeInbound(key, delivery.ContentType, delivery.Body)
+	if err != nil {
+		log.Printf("Rejecting %s from %s: %v", delivery.RoutingKey, username, err)
+		return "NackDiscard"
+	}
+	if msg.Sender() != username {
+		log.Printf("Rejecting %s: %s claimed to be %s", delivery.RoutingKey, username, msg.Sender())
+		return "NackDiscard"
+	}
+
+	if reason := r.mod.check(username, msg); reason != "" {
+		err = r.mod.quarantine(delivery, username, reason)
+		if err != nil {
+			log.Printf("Error quarantining %s: %v", key, err)
+			return "NackRequeue"
+		}
+		return "Ack"
+	}
+
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	delete(headers, routing.SessionHeader)
+	headers[routing.SenderHeader] = username
+
+	relayed := amqp.Publishing{
+		ContentType:  delivery.ContentType,
+		Headers:      headers,
+		Body:         delivery.Body,
+		DeliveryMode: 2,
+	}
+	pubsub.WithRelaySignature(r.serverKey)(key, &relayed)
+	err = pubsub.Publish(ctx, r.ch, exchange, key, relayed)
+	if err != nil {
+		log.Printf("Error relaying %s: %v", key, err)
+		return "NackRequeue"
+	}
+	if chat, ok := msg.(routing.ChatMessage); ok {
+		r.logChat(strings.Split(key, ".")[1], chat)
+	}
+	return "Ack"
+}
+
+// logChat records chat, whispers included, in the game log for moderators.
+func (r *relay) logChat(gameID string, msg routing.ChatMessage) {
+	message := fmt.Sprintf("[%s] %s", msg.Kind, msg.Text)
+	if msg.To != "" {
+		message = fmt.Sprintf("[%s to %s] %s", msg.Kind, msg.To, msg.Text)
+	}
+	r.gameLogs.Add(logstore.Entry{
+		Time:     msg.Time,
+		Username: msg.From,
+		Message:  message,
+		Event:    logstore.EventChat,
+		GameID:   gameID,
+	})
+}
+
+// decodeInbound works out which exchange a relayed key belongs on and decodes
+// the message, checking the player in the key and body agree.
+func decodeInbound(key, contentType string, body []byte) (exchange string, msg pubsub.Sender, err error) {
+	if key == routing.LobbyKey {
+		msg, err = decodeSender[routing.LobbyRequest](contentType, body)
+		if err != nil {
+			return "", nil, err
+		}
+		return routing.ExchangePerilDirect, msg, nil
+	}
+
+	parts := strings.Split(key, ".")
+	if len(parts) > 2 && parts[0] == routing.GamePrefix && parts[2] == routing.ChatPrefix {
+		return decodeChat(parts, contentType, body)
+	}
+	if len(parts) != 4 || parts[0] != routing.GamePrefix {
+		return "", nil, fmt.Errorf("unknown key %s", key)
+	}
+	kind, keyUser := parts[2], parts[3]
+
+	switch kind {
+	case routing.SpawnPrefix:
+		msg, err = decodeSender[gamelogic.Spawn](contentType, body)
+	case routing.ArmyMovesPrefix:
+		msg, err = decodeSender[gamelogic.ArmyMove](contentType, body)
+	case routing.WarRecognitionsPrefix:
+		msg, err = decodeSender[gamelogic.RecognitionOfWar](contentType, body)
+	case routing.DiplomacyPrefix:
+		msg, err = decodeSender[gamelogic.DiplomacyMessage](contentType, body)
+	case routing.GameLogSlug:
+		msg, err = decodeSender[routing.GameLog](contentType, body)
+	case routing.PresencePrefix:
+		msg, err = decodeSender[routing.Presence](contentType, body)
+	default:
+		return "", nil, fmt.Errorf("unknown message kind %s", kind)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if msg.Sender() != keyUser {
+		return "", nil, fmt.Errorf("key is for %s but the message is from %s", keyUser, msg.Sender())
+	}
+	return routing.ExchangePerilTopic, msg, nil
+}
+
+// decodeChat checks a chat key matches its message, see routing.ChatKey.
+func decodeChat(parts []string, contentType string, body []byte) (string, pubsub.Sender, error) {
+	msg, err := decodeSender[routing.ChatMessage](contentType, body)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.TrimSpace(msg.Text) == "" {
+		return "", nil, errors.New("empty chat message")
+	}
+	switch msg.Kind {
+	case routing.ChatSay:
+		if msg.To != "" {
+			return "", nil, errors.New("say messages have no recipient")
+		}
+	case routing.ChatWhisper, routing.ChatAlly:
+		if msg.To == "" {
+			return "", nil, fmt.Errorf("%s messages need a recipient", msg.Kind)
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown chat kind %s", msg.Kind)
+	}
+	key := strings.Join(parts, ".")
+	if want := routing.ChatKey(parts[1], msg.Kind, msg.From, msg.To); key != want {
+		return "", nil, fmt.Errorf("chat key %s does not match the message, expected %s", key, want)
+	}
+	return routing.ExchangePerilTopic, msg, nil
+}
+
+func decodeSender[T pubsub.Sender](contentType string, body []byte) (T, error) {
+	var msg T
+	var err error
+	if contentType == "application/gob" {
+		err = gob.NewDecoder(bytes.NewReader(body)).Decode(&msg)
+	} else {
+		err = json.Unmarshal(body, &msg)
+	}
+	if err != nil {
+		return msg, fmt.Errorf("could not decode %s body: %v", contentType, err)
+	}
+	return msg, nil
+}
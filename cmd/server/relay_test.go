@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func TestDecodeInbound(t *testing.T) {
+	encode := func(v interface{}) []byte {
+		body, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	move := encode(gamelogic.ArmyMove{Player: gamelogic.Player{Username: "alice"}})
+	whisper := encode(routing.ChatMessage{Kind: routing.ChatWhisper, From: "alice", To: "bob", Text: "hi"})
+
+	tests := []struct {
+		name    string
+		key     string
+		body    []byte
+		wantErr string
+	}{
+		{
+			name: "move",
+			key:  routing.GameKey("a1", routing.ArmyMovesPrefix, "alice"),
+			body: move,
+		},
+		{
+			name:    "move under another player's key",
+			key:     routing.GameKey("a1", routing.ArmyMovesPrefix, "bob"),
+			body:    move,
+			wantErr: "key is for bob but the message is from alice",
+		},
+		{
+			name:    "unknown kind",
+			key:     routing.GameKey("a1", routing.PauseKey, "alice"),
+			body:    move,
+			wantErr: "unknown message kind",
+		},
+		{
+			name:    "key outside a game",
+			key:     routing.ModerationPrefix + ".ban",
+			body:    move,
+			wantErr: "unknown key",
+		},
+		{
+			name:    "bad body",
+			key:     routing.GameKey("a1", routing.ArmyMovesPrefix, "alice"),
+			body:    []byte("{"),
+			wantErr: "could not decode",
+		},
+		{
+			name: "whisper",
+			key:  routing.ChatKey("a1", routing.ChatWhisper, "alice", "bob"),
+			body: whisper,
+		},
+		{
+			name:    "whisper under another recipient's key",
+			key:     routing.ChatKey("a1", routing.ChatWhisper, "alice", "carol"),
+			body:    whisper,
+			wantErr: "does not match the message",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			exchange, msg, err := decodeInbound(tc.key, "application/json", tc.body)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exchange != routing.ExchangePerilTopic || msg.Sender() != "alice" {
+				t.Errorf("got %s from %s on %s", tc.key, msg.Sender(), exchange)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/simulation"
+)
+
+func main() {
+	players := flag.Int("players", 3, "players per game")
+	steps := flag.Int("steps", 500, "commands per game")
+	seed := flag.Int64("seed", 1, "seed of the first game")
+	runs := flag.Int("runs", 1, "games to play, with consecutive seeds")
+	pauseEvery := flag.Int("pause-every", 25, "pause the game every this many steps (0 never)")
+	strictWars := flag.Bool("strict-wars", false, "also check the defender's side of every war")
+	verbose := flag.Bool("verbose", false, "show the game output")
+	flag.Parse()
+
+	failed := 0
+	for i := range *runs {
+		cfg := simulation.Config{
+			Players:    *players,
+			Steps:      *steps,
+			Seed:       *seed + int64(i),
+			PauseEvery: *pauseEvery,
+			StrictWars: *strictWars,
+			Verbose:    *verbose,
+		}
+		report, err := simulation.Run(cfg)
+		fmt.Printf("seed %d: %s\n", cfg.Seed, report)
+		if err != nil {
+			failed++
+			fmt.Println(err)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d games broke an invariant\n", failed, *runs)
+		os.Exit(1)
+	}
+}
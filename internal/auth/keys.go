@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LoadOrCreateKey reads a player's or the server's Ed25519 private key,
+// generating it on first run.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	seed, err := os.ReadFile(path)
+	if err == nil {
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read key: %v", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create key directory: %v", err)
+	}
+	err = os.WriteFile(path, key.Seed(), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not write key: %v", err)
+	}
+	return key, nil
+}
+
+// KeyStore pins each player's public key in a JSON file, like UserStore.
+type KeyStore struct {
+	path string
+	mu   *sync.Mutex
+}
+
+func NewKeyStore(path string) *KeyStore {
+	return &KeyStore{
+		path: path,
+		mu:   &sync.Mutex{},
+	}
+}
+
+// Register records a player's public key. An existing key is only replaced
+// when replace is set, i.e. the player proved who they are with a password.
+func (s *KeyStore) Register(username string, key ed25519.PublicKey, replace bool) error {
+	if len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	if current, ok := keys[username]; ok && !replace && !bytes.Equal(current, key) {
+		return fmt.Errorf("this key does not match the one registered for %s, log in with your password to replace it", username)
+	}
+	keys[username] = key
+	return s.save(keys)
+}
+
+func (s *KeyStore) All() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *KeyStore) load() (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read key store: %v", err)
+	}
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key store: %v", err)
+	}
+	return keys, nil
+}
+
+func (s *KeyStore) save(keys map[string][]byte) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write key store: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
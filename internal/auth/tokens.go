@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid session token")
+
+// Tokens issues and verifies session tokens of the form
+// base64(username).expiry.base64(hmac). They need no server-side state, so
+// any server holding the same secret can verify them.
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokens(secret []byte, ttl time.Duration) *Tokens {
+	return &Tokens{
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// LoadOrCreateSecret reads the token signing secret, generating it on first run.
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read secret: %v", err)
+	}
+	secret = make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(path, secret, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not write secret: %v", err)
+	}
+	return secret, nil
+}
+
+func (t *Tokens) Issue(username string) string {
+	payload := fmt.Sprintf("%s.%d", base64.RawURLEncoding.EncodeToString([]byte(username)), time.Now().Add(t.ttl).Unix())
+	return payload + "." + t.sign(payload)
+}
+
+// Verify returns the username a token was issued to.
+func (t *Tokens) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(t.sign(payload)), []byte(parts[2])) {
+		return "", ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() > expiry {
+		return "", errors.New("session token expired")
+	}
+	username, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	return string(username), nil
+}
+
+func (t *Tokens) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
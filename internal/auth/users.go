@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWrongPassword = errors.New("wrong username or password")
+
+// Usernames end up in routing keys and queue names, so no dots or wildcards.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+func ValidUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username %q: use 1-32 letters, digits, '-' or '_'", username)
+	}
+	return nil
+}
+
+// UserStore keeps bcrypt password hashes in a JSON file. The file is re-read
+// on every login so several servers can share it.
+type UserStore struct {
+	path string
+	mu   *sync.Mutex
+}
+
+func NewUserStore(path string) *UserStore {
+	return &UserStore{
+		path: path,
+		mu:   &sync.Mutex{},
+	}
+}
+
+// Authenticate checks a password, registering the username on first use.
+func (s *UserStore) Authenticate(username, password string) (registered bool, err error) {
+	if err := ValidUsername(username); err != nil {
+		return false, err
+	}
+	if password == "" {
+		return false, errors.New("a password is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return false, err
+	}
+
+	if hash, ok := users[username]; ok {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, ErrWrongPassword
+		}
+		return false, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+	users[username] = string(hash)
+	return true, s.save(users)
+}
+
+func (s *UserStore) load() (map[string]string, error) {
+	users := map[string]string{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read user store: %v", err)
+	}
+	err = json.Unmarshal(data, &users)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse user store: %v", err)
+	}
+	return users, nil
+}
+
+func (s *UserStore) save(users map[string]string) error {
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write user store: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
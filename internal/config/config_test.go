@@ -0,0 +1,230 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// writeCert writes a self-signed certificate and its key to dir as
+// <name>.pem and <name>.key.
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBrokerAMQP(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeCert(t, dir, "ca")
+	certFile, keyFile := writeCert(t, dir, "alice")
+	_, otherKeyFile := writeCert(t, dir, "bob")
+	emptyCA := filepath.Join(dir, "empty.pem")
+	err := os.WriteFile(emptyCA, []byte("not a certificate\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		broker  Broker
+		wantErr string
+	}{
+		{
+			name:   "plain without TLS",
+			broker: Broker{URL: "amqp://localhost:5672/", Auth: "plain"},
+		},
+		{
+			name:   "plain with a user",
+			broker: Broker{URL: "amqp://localhost:5672/", Auth: "plain", User: "alice", Password: "secret"},
+		},
+		{
+			name:    "unknown auth",
+			broker:  Broker{URL: "amqp://localhost:5672/", Auth: "kerberos"},
+			wantErr: "unknown broker auth",
+		},
+		{
+			name:    "external without a cert",
+			broker:  Broker{URL: "amqps://localhost:5671/", Auth: "external", CAFile: caFile},
+			wantErr: "needs a client certificate",
+		},
+		{
+			name:    "TLS options with an amqp URL",
+			broker:  Broker{URL: "amqp://localhost:5672/", Auth: "plain", CAFile: caFile},
+			wantErr: "need an amqps:// URL",
+		},
+		{
+			name:    "unreadable CA file",
+			broker:  Broker{URL: "amqps://localhost:5671/", Auth: "plain", CAFile: filepath.Join(dir, "missing.pem")},
+			wantErr: "could not read broker CA bundle",
+		},
+		{
+			name:    "CA file without certificates",
+			broker:  Broker{URL: "amqps://localhost:5671/", Auth: "plain", CAFile: emptyCA},
+			wantErr: "no certificates found",
+		},
+		{
+			name:    "cert without a key",
+			broker:  Broker{URL: "amqps://localhost:5671/", Auth: "plain", CertFile: certFile},
+			wantErr: "needs both a cert file and a key file",
+		},
+		{
+			name:    "mismatched cert and key",
+			broker:  Broker{URL: "amqps://localhost:5671/", Auth: "external", CertFile: certFile, KeyFile: otherKeyFile},
+			wantErr: "could not load broker client certificate",
+		},
+		{
+			name:   "external with a cert",
+			broker: Broker{URL: "amqps://localhost:5671/", Auth: "external", CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "localhost"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := tc.broker.AMQP()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			usesTLS := strings.HasPrefix(tc.broker.URL, "amqps://")
+			if (cfg.TLSClientConfig != nil) != usesTLS {
+				t.Errorf("TLS config %v for %s", cfg.TLSClientConfig, tc.broker.URL)
+			}
+			if tc.broker.User != "" && len(cfg.SASL) != 1 {
+				t.Errorf("expected plain auth for %s, got %v", tc.broker.User, cfg.SASL)
+			}
+		})
+	}
+}
+
+func TestBrokerAMQPExternal(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeCert(t, dir, "ca")
+	certFile, keyFile := writeCert(t, dir, "alice")
+	cfg, err := Broker{URL: "amqps://localhost:5671/", Auth: "external", CAFile: caFile, CertFile: certFile, KeyFile: keyFile}.AMQP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.SASL) != 1 || cfg.SASL[0].Mechanism() != "EXTERNAL" {
+		t.Errorf("expected EXTERNAL auth, got %v", cfg.SASL)
+	}
+	if cfg.TLSClientConfig.RootCAs == nil {
+		t.Error("expected the CA bundle to be trusted")
+	}
+	if len(cfg.TLSClientConfig.Certificates) != 1 {
+		t.Errorf("expected the client certificate, got %d", len(cfg.TLSClientConfig.Certificates))
+	}
+}
+
+// TestBrokerDialTLS logs in with the certificates from "certs.sh init" to a
+// broker started with "rabbit.sh start-tls", after "rabbit.sh add-server
+// peril-server". It is skipped when either is missing.
+func TestBrokerDialTLS(t *testing.T) {
+	certs := filepath.Join("..", "..", "peril_certs")
+	if _, err := os.Stat(filepath.Join(certs, "peril-server.pem")); err != nil {
+		t.Skip("no certificates, run ./certs.sh init")
+	}
+	probe, err := net.DialTimeout("tcp", "localhost:5671", time.Second)
+	if err != nil {
+		t.Skip("no broker listening for TLS, run ./rabbit.sh start-tls")
+	}
+	probe.Close()
+
+	broker := Broker{
+		URL:      "amqps://localhost:5671/",
+		Auth:     "external",
+		CAFile:   filepath.Join(certs, "ca.pem"),
+		CertFile: filepath.Join(certs, "peril-server.pem"),
+		KeyFile:  filepath.Join(certs, "peril-server.key"),
+	}
+	cfg, err := broker.AMQP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := amqp.DialConfig(broker.URL, cfg)
+	if err != nil {
+		t.Fatalf("could not connect as peril-server: %v", err)
+	}
+	conn.Close()
+}
+
+func TestLoadDurations(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"--log-flush", "1s", "--presence-timeout", "1m"}},
+		{args: []string{"--log-max-age", "0"}},
+		{args: []string{"--log-flush", "0"}, wantErr: "--log-flush must be positive, got 0s"},
+		{args: []string{"--presence-timeout", "0s"}, wantErr: "--presence-timeout must be positive"},
+		{args: []string{"--session-ttl", "-1h"}, wantErr: "--session-ttl must be positive"},
+		{args: []string{"--time-limit", "-5m"}, wantErr: "--time-limit can not be negative"},
+	}
+	for _, tc := range tests {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			_, _, err := Load(fs, tc.args)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
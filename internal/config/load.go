@@ -0,0 +1,288 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// setting is one field of a Config.
+type setting struct {
+	section string
+	key     string
+	flag    string
+	help    string
+	secret  string
+	// positive is set for durations that must be more than zero.
+	positive bool
+	value    reflect.Value
+}
+
+func (s setting) name() string {
+	return s.section + "." + s.key
+}
+
+func (s setting) env() string {
+	return "PERIL_" + strings.ToUpper(s.section+"_"+s.key)
+}
+
+// settings lists every setting of c in declaration order.
+func (c *Config) settings() []setting {
+	list := []setting{}
+	sections := reflect.ValueOf(c).Elem()
+	for i := range sections.NumField() {
+		sectionField := sections.Type().Field(i)
+		if !sectionField.IsExported() {
+			continue
+		}
+		section := sections.Field(i)
+		for j := range section.NumField() {
+			field := section.Type().Field(j)
+			list = append(list, setting{
+				section:  sectionField.Tag.Get("json"),
+				key:      field.Tag.Get("json"),
+				flag:     field.Tag.Get("flag"),
+				help:     field.Tag.Get("help"),
+				secret:   field.Tag.Get("secret"),
+				positive: field.Tag.Get("positive") == "true",
+				value:    section.Field(j),
+			})
+		}
+	}
+	return list
+}
+
+// isSelected reports whether a setting is one a command asked for, by its
+// section or its own name.
+func (c *Config) isSelected(s setting) bool {
+	if len(c.selected) == 0 {
+		return true
+	}
+	for _, name := range c.selected {
+		if name == s.section || name == s.name() {
+			return true
+		}
+	}
+	return false
+}
+
+// Load registers flags on fs for the settings a command uses, named by
+// section like "broker" or one by one like "game.combine_allies" (none means
+// all), and parses args. It returns the arguments that are not flags, which
+// may come before, after or between them, so "config print" can be followed
+// by flags.
+func Load(fs *flag.FlagSet, args []string, only ...string) (*Config, []string, error) {
+	c := Default()
+	c.selected = only
+	path := fs.String("config", os.Getenv("PERIL_CONFIG"), "JSON config file to read settings from ($PERIL_CONFIG)")
+	for _, s := range c.settings() {
+		if c.isSelected(s) {
+			register(fs, s)
+		}
+	}
+
+	rest := []string{}
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+	// The flags are already parsed into c, so note them to set again once
+	// the file and environment have had their say.
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+
+	if *path != "" {
+		err := c.loadFile(fs, *path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range c.settings() {
+		if !c.isSelected(s) {
+			continue
+		}
+		value, ok := os.LookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		err := fs.Set(s.flag, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid $%s: %v", s.env(), err)
+		}
+	}
+	for name, value := range given {
+		err := fs.Set(name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err := c.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, rest, nil
+}
+
+// validate rejects durations that would make no sense, like a zero flush
+// interval, before anything starts a ticker with them.
+func (c *Config) validate() error {
+	for _, s := range c.settings() {
+		d, ok := s.value.Interface().(time.Duration)
+		if !ok || !c.isSelected(s) {
+			continue
+		}
+		if d < 0 || (d == 0 && s.positive) {
+			if s.positive {
+				return fmt.Errorf("--%s must be positive, got %v", s.flag, d)
+			}
+			return fmt.Errorf("--%s can not be negative, got %v", s.flag, d)
+		}
+	}
+	return nil
+}
+
+func register(fs *flag.FlagSet, s setting) {
+	help := fmt.Sprintf("%s ($%s)", s.help, s.env())
+	switch p := s.value.Addr().Interface().(type) {
+	case *string:
+		fs.StringVar(p, s.flag, *p, help)
+	case *int:
+		fs.IntVar(p, s.flag, *p, help)
+	case *int64:
+		fs.Int64Var(p, s.flag, *p, help)
+	case *float64:
+		fs.Float64Var(p, s.flag, *p, help)
+	case *bool:
+		fs.BoolVar(p, s.flag, *p, help)
+	case *time.Duration:
+		fs.DurationVar(p, s.flag, *p, help)
+	default:
+		panic(fmt.Sprintf("config: %s has unsupported type %T", s.name(), p))
+	}
+}
+
+// loadFile reads a JSON file of sections of settings, like the output of
+// Print. Settings this command does not use are skipped, so every command
+// can share one file, but unknown ones are an error.
+func (c *Config) loadFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %v", err)
+	}
+	file := map[string]map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+	known := map[string]setting{}
+	for _, s := range c.settings() {
+		known[s.name()] = s
+	}
+	for section, values := range file {
+		for key, raw := range values {
+			s, ok := known[section+"."+key]
+			if !ok {
+				return fmt.Errorf("unknown setting %s.%s in %s", section, key, path)
+			}
+			if !c.isSelected(s) {
+				continue
+			}
+			// Strings are unquoted; numbers and booleans are used as written.
+			value := string(raw)
+			var str string
+			if json.Unmarshal(raw, &str) == nil {
+				value = str
+			}
+			err := fs.Set(s.flag, value)
+			if err != nil {
+				return fmt.Errorf("invalid %s in %s: %v", s.name(), path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Print writes the settings Load read in the config file format, with
+// secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("{")
+	section := ""
+	for _, s := range c.settings() {
+		if !c.isSelected(s) {
+			continue
+		}
+		if s.section != section {
+			if section != "" {
+				b.WriteString("\n\t},")
+			}
+			fmt.Fprintf(&b, "\n\t%q: {", s.section)
+			section = s.section
+		} else {
+			b.WriteString(",")
+		}
+		value, err := json.Marshal(s.printable())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\n\t\t%q: %s", s.key, value)
+	}
+	if section != "" {
+		b.WriteString("\n\t}")
+	}
+	b.WriteString("\n}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (s setting) printable() interface{} {
+	switch v := s.value.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case string:
+		if v == "" {
+			return v
+		}
+		switch s.secret {
+		case "true":
+			return "REDACTED"
+		case "password":
+			u, err := url.Parse(v)
+			if err != nil {
+				return "REDACTED"
+			}
+			return u.Redacted()
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// RunCommand runs "config print", reporting whether args held a command.
+func (c *Config) RunCommand(args []string, w io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+		return true, fmt.Errorf("unknown command %q, the only one is \"config print\"", strings.Join(args, " "))
+	}
+	return true, c.Print(w)
+}
@@ -0,0 +1,40 @@
+package gamelogic
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) HandleWipe(w routing.Wipe) {
+	if w.Target != gs.GetUsername() {
+		gs.mu.Lock()
+		if ally, ok := gs.allySnaps[w.Target]; ok {
+			gs.allySnaps[w.Target] = wipeUnits(ally, w.Region)
+		}
+		gs.mu.Unlock()
+		return
+	}
+
+	gs.mu.Lock()
+	gs.Player = wipeUnits(gs.Player, w.Region)
+	gs.mu.Unlock()
+	gs.present(UnitsWiped{Wipe: w})
+}
+
+func (gs *GameState) HandleAdmin(m routing.Moderation) {
+	gs.present(AdminAction{Moderation: m})
+}
+
+func (r *Referee) HandleWipe(w routing.Wipe) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.players[w.Target]; ok {
+		r.players[w.Target] = wipeUnits(p, w.Region)
+	}
+}
+
+func wipeUnits(p Player, region string) Player {
+	if region == "" {
+		return Player{Username: p.Username, Units: map[int]Unit{}}
+	}
+	return withoutUnitsInLocation(p, Location(region))
+}
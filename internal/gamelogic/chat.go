@@ -0,0 +1,78 @@
+package gamelogic
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) CommandSay(words []string) (routing.ChatMessage, error) {
+	if len(words) < 2 {
+		return routing.ChatMessage{}, errors.New("usage: say <message>")
+	}
+	return routing.ChatMessage{
+		Kind: routing.ChatSay,
+		From: gs.GetUsername(),
+		Text: strings.Join(words[1:], " "),
+		Time: time.Now(),
+	}, nil
+}
+
+func (gs *GameState) CommandWhisper(words []string) (routing.ChatMessage, error) {
+	if len(words) < 3 {
+		return routing.ChatMessage{}, errors.New("usage: whisper <player> <message>")
+	}
+	if words[1] == gs.GetUsername() {
+		return routing.ChatMessage{}, errors.New("you can not whisper to yourself")
+	}
+	return routing.ChatMessage{
+		Kind: routing.ChatWhisper,
+		From: gs.GetUsername(),
+		To:   words[1],
+		Text: strings.Join(words[2:], " "),
+		Time: time.Now(),
+	}, nil
+}
+
+// CommandAllyChat returns one message per ally, so only allies receive it.
+func (gs *GameState) CommandAllyChat(words []string) ([]routing.ChatMessage, error) {
+	if len(words) < 2 {
+		return nil, errors.New("usage: ally-chat <message>")
+	}
+	msgs := []routing.ChatMessage{}
+	for username, relation := range gs.GetRelations() {
+		if relation != RelationAlliance {
+			continue
+		}
+		msgs = append(msgs, routing.ChatMessage{
+			Kind: routing.ChatAlly,
+			From: gs.GetUsername(),
+			To:   username,
+			Text: strings.Join(words[1:], " "),
+			Time: time.Now(),
+		})
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("you have no allies to talk to")
+	}
+	return msgs, nil
+}
+
+// HandleChat shows a chat message meant for this player and reports whether
+// it was shown.
+func (gs *GameState) HandleChat(msg routing.ChatMessage) bool {
+	me := gs.GetUsername()
+	switch {
+	case msg.From == me:
+		return false
+	case msg.Kind == routing.ChatWhisper && msg.To != me:
+		return false
+	case msg.Kind == routing.ChatAlly && (msg.To != me || gs.GetRelation(msg.From) != RelationAlliance):
+		return false
+	}
+
+	gs.present(ChatReceived{Message: msg})
+	return true
+}
@@ -0,0 +1,166 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (gs *GameState) CommandPropose(words []string, relation Relation) (DiplomacyMessage, error) {
+	if len(words) < 2 {
+		return DiplomacyMessage{}, fmt.Errorf("usage: %s <player>", words[0])
+	}
+	target := words[1]
+	if target == gs.GetUsername() {
+		return DiplomacyMessage{}, errors.New("you can not make a treaty with yourself")
+	}
+	if current := gs.GetRelation(target); current != RelationNone {
+		return DiplomacyMessage{}, fmt.Errorf("you already have a(n) %s with %s", current, target)
+	}
+
+	gs.mu.Lock()
+	gs.outgoing[target] = relation
+	gs.mu.Unlock()
+
+	dm := DiplomacyMessage{
+		Action:   DiplomacyPropose,
+		Relation: relation,
+		From:     gs.GetUsername(),
+		To:       target,
+	}
+	gs.present(DiplomacySent{Message: dm})
+	return dm, nil
+}
+
+func (gs *GameState) CommandAccept(words []string) (DiplomacyMessage, error) {
+	dm, err := gs.accept(words)
+	if err != nil {
+		return DiplomacyMessage{}, err
+	}
+	gs.present(DiplomacySent{Message: dm})
+	return dm, nil
+}
+
+func (gs *GameState) accept(words []string) (DiplomacyMessage, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	var proposer string
+	switch {
+	case len(words) >= 2:
+		proposer = words[1]
+	case len(gs.proposals) == 1:
+		for from := range gs.proposals {
+			proposer = from
+		}
+	case len(gs.proposals) == 0:
+		return DiplomacyMessage{}, errors.New("you have no pending proposals")
+	default:
+		return DiplomacyMessage{}, errors.New("usage: accept <player>")
+	}
+
+	relation, ok := gs.proposals[proposer]
+	if !ok {
+		return DiplomacyMessage{}, fmt.Errorf("error: %s has not proposed anything", proposer)
+	}
+	delete(gs.proposals, proposer)
+	gs.relations[proposer] = relation
+
+	return DiplomacyMessage{
+		Action:   DiplomacyAccept,
+		Relation: relation,
+		From:     gs.Player.Username,
+		To:       proposer,
+	}, nil
+}
+
+func (gs *GameState) CommandBreakAlliance(words []string) (DiplomacyMessage, error) {
+	if len(words) < 2 {
+		return DiplomacyMessage{}, errors.New("usage: break-alliance <player>")
+	}
+	target := words[1]
+
+	gs.mu.Lock()
+	relation, ok := gs.relations[target]
+	if !ok {
+		gs.mu.Unlock()
+		return DiplomacyMessage{}, fmt.Errorf("error: you have no treaty with %s", target)
+	}
+	delete(gs.relations, target)
+	delete(gs.allySnaps, target)
+	gs.mu.Unlock()
+
+	dm := DiplomacyMessage{
+		Action:   DiplomacyBreak,
+		Relation: relation,
+		From:     gs.GetUsername(),
+		To:       target,
+	}
+	gs.present(DiplomacySent{Message: dm})
+	return dm, nil
+}
+
+func (gs *GameState) HandleDiplomacy(dm DiplomacyMessage) {
+	if dm.To != gs.GetUsername() {
+		return
+	}
+	gs.present(DiplomacyReceived{Message: dm, Ignored: !gs.applyDiplomacy(dm)})
+}
+
+// applyDiplomacy updates the treaties, returning false for an acceptance of
+// something this player never proposed.
+func (gs *GameState) applyDiplomacy(dm DiplomacyMessage) bool {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	switch dm.Action {
+	case DiplomacyPropose:
+		gs.proposals[dm.From] = dm.Relation
+	case DiplomacyAccept:
+		if gs.outgoing[dm.From] != dm.Relation {
+			return false
+		}
+		delete(gs.outgoing, dm.From)
+		gs.relations[dm.From] = dm.Relation
+	case DiplomacyBreak:
+		delete(gs.relations, dm.From)
+		delete(gs.proposals, dm.From)
+		delete(gs.outgoing, dm.From)
+		delete(gs.allySnaps, dm.From)
+	}
+	return true
+}
+
+func (gs *GameState) GetRelation(username string) Relation {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.relations[username]
+}
+
+func (gs *GameState) GetRelations() map[string]Relation {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	relations := map[string]Relation{}
+	for k, v := range gs.relations {
+		relations[k] = v
+	}
+	return relations
+}
+
+func (gs *GameState) recordAllySnap(p Player) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.relations[p.Username] != RelationAlliance {
+		return
+	}
+	gs.allySnaps[p.Username] = p
+}
+
+// GetAllySnaps returns the last known unit positions of every ally, as seen in their moves.
+func (gs *GameState) GetAllySnaps() []Player {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	allies := []Player{}
+	for _, p := range gs.allySnaps {
+		allies = append(allies, p)
+	}
+	return allies
+}
@@ -0,0 +1,422 @@
+package gamelogic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Event is something the game wants the player to know about. Lines is how it
+// reads as text; presenters that want more can switch on the concrete type.
+type Event interface {
+	Lines() []string
+}
+
+// titled events are shown as a block under a heading, like "==== Move Detected ====".
+type titled interface {
+	Event
+	Title() string
+}
+
+type UnitSpawned struct {
+	Unit Unit
+}
+
+func (e UnitSpawned) Lines() []string {
+	return []string{fmt.Sprintf("Spawned a(n) %s in %s with id %v", e.Unit.Rank, e.Unit.Location, e.Unit.ID)}
+}
+
+type UnitsMoved struct {
+	Move ArmyMove
+}
+
+func (e UnitsMoved) Lines() []string {
+	return []string{fmt.Sprintf("Moved %v units to %s", len(e.Move.Units), e.Move.ToLocation)}
+}
+
+type MoveDetected struct {
+	Move     ArmyMove
+	Outcome  MoveOutcome
+	Relation Relation
+	// Location is where the war starts, for MoveOutcomeMakeWar.
+	Location Location
+}
+
+func (e MoveDetected) Title() string {
+	return "Move Detected"
+}
+
+func (e MoveDetected) Lines() []string {
+	from := e.Move.Player.Username
+	lines := []string{fmt.Sprintf("%s is moving %v unit(s) to %s", from, len(e.Move.Units), e.Move.ToLocation)}
+	for _, unit := range e.Move.Units {
+		lines = append(lines, fmt.Sprintf("* %v", unit.Rank))
+	}
+	switch {
+	case e.Outcome == MoveOutcomeSamePlayer:
+	case e.Relation != RelationNone:
+		lines = append(lines, fmt.Sprintf("You have a(n) %s with %s. Your units may share regions.", e.Relation, from))
+	case e.Outcome == MoveOutcomeMakeWar:
+		lines = append(lines, fmt.Sprintf("You have units in %s! You are at war with %s!", e.Location, from))
+	default:
+		lines = append(lines, fmt.Sprintf("You are safe from %s's units.", from))
+	}
+	return lines
+}
+
+type WarResolved struct {
+	War      RecognitionOfWar
+	Player   string
+	Outcome  WarOutcome
+	Relation Relation
+	Location Location
+	// The units and power on each side, once a war is fought.
+	AttackerUnits []Unit
+	DefenderUnits []Unit
+	AttackerPower int
+	DefenderPower int
+	Winner        string
+	Loser         string
+}
+
+func (e WarResolved) Title() string {
+	return "War Declared"
+}
+
+func (e WarResolved) Lines() []string {
+	attacker, defender := e.War.Attacker.Username, e.War.Defender.Username
+	lines := []string{fmt.Sprintf("%s has declared war on %s!", attacker, defender)}
+	switch e.Outcome {
+	case WarOutcomeNotInvolved:
+		if e.Player == defender {
+			return append(lines, fmt.Sprintf("%s, you published the war.", e.Player))
+		}
+		return append(lines, fmt.Sprintf("%s, you are not involved in this war.", e.Player))
+	case WarOutcomeAllied:
+		return append(lines, fmt.Sprintf("You have a(n) %s with %s. No war will be fought.", e.Relation, defender))
+	case WarOutcomeNoUnits:
+		return append(lines, "Error! No units are in the same location. No war will be fought.")
+	}
+
+	lines = append(lines, fmt.Sprintf("%s's units:", attacker))
+	for _, unit := range e.AttackerUnits {
+		lines = append(lines, fmt.Sprintf("  * %v", unit.Rank))
+	}
+	lines = append(lines, fmt.Sprintf("%s's units:", defender))
+	for _, unit := range e.DefenderUnits {
+		lines = append(lines, fmt.Sprintf("  * %v", unit.Rank))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Attacker has a power level of %v", e.AttackerPower),
+		fmt.Sprintf("Defender has a power level of %v", e.DefenderPower),
+	)
+	switch e.Outcome {
+	case WarOutcomeYouWon:
+		lines = append(lines, fmt.Sprintf("%s has won the war!", e.Winner))
+	case WarOutcomeOpponentWon:
+		lines = append(lines,
+			fmt.Sprintf("%s has won the war!", e.Winner),
+			"You have lost the war!",
+			fmt.Sprintf("Your units in %s have been killed.", e.Location),
+		)
+	case WarOutcomeDraw:
+		lines = append(lines,
+			"The war ended in a draw!",
+			fmt.Sprintf("Your units in %s have been killed.", e.Location),
+		)
+	}
+	return lines
+}
+
+type PauseChanged struct {
+	State routing.PlayingState
+	// Ignored is set when a resume arrives after the game is over.
+	Ignored bool
+}
+
+func (e PauseChanged) Title() string {
+	switch {
+	case e.Ignored:
+		return "Resume Ignored: the game is over"
+	case e.State.Scope != "" && e.State.IsPaused:
+		return fmt.Sprintf("Pause Detected: %s %s", e.State.Scope, e.State.Target)
+	case e.State.Scope != "":
+		return fmt.Sprintf("Resume Detected: %s %s", e.State.Scope, e.State.Target)
+	case e.State.IsPaused:
+		return "Pause Detected"
+	}
+	return "Resume Detected"
+}
+
+func (e PauseChanged) Lines() []string {
+	lines := []string{}
+	if e.Ignored {
+		return lines
+	}
+	if e.State.IsPaused && e.State.Duration > 0 {
+		lines = append(lines, fmt.Sprintf("Resumes automatically in %v", e.State.Duration))
+	}
+	if e.State.Reason != "" {
+		lines = append(lines, fmt.Sprintf("Reason: %s", e.State.Reason))
+	}
+	return lines
+}
+
+// DiplomacySent is a proposal, acceptance or break this player made.
+type DiplomacySent struct {
+	Message DiplomacyMessage
+}
+
+func (e DiplomacySent) Lines() []string {
+	m := e.Message
+	switch m.Action {
+	case DiplomacyPropose:
+		return []string{fmt.Sprintf("Proposed a(n) %s to %s", m.Relation, m.To)}
+	case DiplomacyAccept:
+		return []string{fmt.Sprintf("You accepted a(n) %s with %s", m.Relation, m.To)}
+	}
+	return []string{fmt.Sprintf("You broke your %s with %s", m.Relation, m.To)}
+}
+
+type DiplomacyReceived struct {
+	Message DiplomacyMessage
+	// Ignored is set for an acceptance of something never proposed.
+	Ignored bool
+}
+
+func (e DiplomacyReceived) Title() string {
+	return "Diplomacy"
+}
+
+func (e DiplomacyReceived) Lines() []string {
+	m := e.Message
+	switch {
+	case e.Ignored:
+		return []string{fmt.Sprintf("%s accepted a(n) %s you never proposed. Ignoring.", m.From, m.Relation)}
+	case m.Action == DiplomacyPropose:
+		return []string{fmt.Sprintf("%s proposes a(n) %s. Type \"accept %s\" to agree.", m.From, m.Relation, m.From)}
+	case m.Action == DiplomacyAccept:
+		return []string{fmt.Sprintf("%s accepted your %s!", m.From, m.Relation)}
+	}
+	return []string{fmt.Sprintf("%s broke your %s!", m.From, m.Relation)}
+}
+
+type UnitsWiped struct {
+	Wipe routing.Wipe
+}
+
+func (e UnitsWiped) Title() string {
+	return "Units Removed by the Server"
+}
+
+func (e UnitsWiped) Lines() []string {
+	lines := []string{"All of your units have been removed."}
+	if e.Wipe.Region != "" {
+		lines = []string{fmt.Sprintf("Your units in %s have been removed.", e.Wipe.Region)}
+	}
+	if e.Wipe.Reason != "" {
+		lines = append(lines, fmt.Sprintf("Reason: %s", e.Wipe.Reason))
+	}
+	return lines
+}
+
+type AdminAction struct {
+	Moderation routing.Moderation
+}
+
+func (e AdminAction) Title() string {
+	switch e.Moderation.Action {
+	case routing.ModerationKick:
+		return "You Have Been Kicked"
+	case routing.ModerationBan:
+		return "You Have Been Banned"
+	}
+	return fmt.Sprintf("Admin Action: %s", e.Moderation.Action)
+}
+
+func (e AdminAction) Lines() []string {
+	if e.Moderation.Reason == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("Reason: %s", e.Moderation.Reason)}
+}
+
+type GameEnded struct {
+	GameOver routing.GameOver
+	// Player is who is watching, so they can be told they won.
+	Player string
+}
+
+func (e GameEnded) Title() string {
+	return "Game Over"
+}
+
+func (e GameEnded) Lines() []string {
+	g := e.GameOver
+	lines := []string{fmt.Sprintf("%s won! %s", g.Winner, g.Reason)}
+	if g.Winner == "" {
+		lines = []string{fmt.Sprintf("The game ended without a winner: %s", g.Reason)}
+	} else if g.Winner == e.Player {
+		lines = []string{fmt.Sprintf("You won! %s", g.Reason)}
+	}
+	return append(lines, standingsLines(g.Standings)...)
+}
+
+type ChatReceived struct {
+	Message routing.ChatMessage
+}
+
+func (e ChatReceived) Lines() []string {
+	msg := e.Message
+	prefix := ""
+	switch msg.Kind {
+	case routing.ChatWhisper:
+		prefix = " (whisper)"
+	case routing.ChatAlly:
+		prefix = " (ally)"
+	}
+	return []string{fmt.Sprintf("[%s] %s%s: %s", msg.Time.Format(time.Kitchen), msg.From, prefix, msg.Text)}
+}
+
+type Status struct {
+	Player    Player
+	Paused    bool
+	Relations map[string]Relation
+}
+
+func (e Status) Lines() []string {
+	if e.Paused {
+		return []string{"The game is paused."}
+	}
+	lines := []string{
+		"The game is not paused.",
+		fmt.Sprintf("You are %s, and you have %d units.", e.Player.Username, len(e.Player.Units)),
+	}
+	for _, unit := range e.Player.Units {
+		lines = append(lines, fmt.Sprintf("* %v: %v, %v", unit.ID, unit.Location, unit.Rank))
+	}
+	for username, relation := range e.Relations {
+		lines = append(lines, fmt.Sprintf("You have a(n) %s with %s.", relation, username))
+	}
+	return lines
+}
+
+// ClientHelp lists the commands a player can type.
+type ClientHelp struct{}
+
+func (e ClientHelp) Lines() []string {
+	return []string{
+		"Possible commands:",
+		"* move <location> <unitID> <unitID> <unitID>...",
+		"    example:",
+		"    move asia 1",
+		"* spawn <location> <rank>",
+		"    example:",
+		"    spawn europe infantry",
+		"* status",
+		"* players",
+		"* propose-alliance <player>",
+		"* propose-pact <player>",
+		"* accept [player]",
+		"* break-alliance <player>",
+		"* say <message>",
+		"* whisper <player> <message>",
+		"* ally-chat <message>",
+		"* spam <n>",
+		"    example:",
+		"    spam 5",
+		"* quit",
+		"* help",
+	}
+}
+
+// PlayersOnline is the reply to the players command.
+type PlayersOnline struct {
+	Entries []presence.Entry
+}
+
+func (e PlayersOnline) Lines() []string {
+	if len(e.Entries) == 0 {
+		return []string{"Nobody is online."}
+	}
+	lines := []string{}
+	for _, entry := range e.Entries {
+		idle := "never active"
+		if !entry.LastActive.IsZero() {
+			idle = fmt.Sprintf("idle %v", time.Since(entry.LastActive).Round(time.Second))
+		}
+		lines = append(lines, fmt.Sprintf("* %s (game %s): %d unit(s), %s, last seen %v ago", entry.Username, entry.GameID, entry.Units, idle, time.Since(entry.LastSeen).Round(time.Second)))
+	}
+	return lines
+}
+
+type Quit struct{}
+
+func (e Quit) Lines() []string {
+	return []string{"I hate this game! (╯°□°)╯︵ ┻━┻"}
+}
+
+// CommandFailed is a command the player typed that could not be carried out.
+type CommandFailed struct {
+	Error string
+}
+
+func (e CommandFailed) Lines() []string {
+	return []string{e.Error}
+}
+
+// FeedItem is a line in a spectator's live feed.
+type FeedItem struct {
+	Time time.Time
+	Text string
+}
+
+func (e FeedItem) Lines() []string {
+	return []string{fmt.Sprintf("[%s] %s", e.Time.Format(time.Kitchen), e.Text)}
+}
+
+// Board is a spectator's overview of the units known in each region.
+type Board struct {
+	GameID string
+	Over   bool
+	Paused bool
+	// Units counts units per region per player.
+	Units map[string]map[string]int
+}
+
+func (e Board) Lines() []string {
+	lines := []string{fmt.Sprintf("Game %s is in progress.", e.GameID)}
+	switch {
+	case e.Over:
+		lines = []string{fmt.Sprintf("Game %s is over.", e.GameID)}
+	case e.Paused:
+		lines = []string{fmt.Sprintf("Game %s is paused.", e.GameID)}
+	}
+	if len(e.Units) == 0 {
+		return append(lines, "No armies have moved yet.")
+	}
+	for _, loc := range Locations() {
+		counts := ""
+		for _, username := range sortedKeys(e.Units[loc]) {
+			if counts != "" {
+				counts += ", "
+			}
+			counts += fmt.Sprintf("%s %d", username, e.Units[loc][username])
+		}
+		if counts == "" {
+			counts = "empty"
+		}
+		lines = append(lines, fmt.Sprintf("* %s: %s", loc, counts))
+	}
+	return lines
+}
+
+func standingsLines(standings []routing.Standing) []string {
+	lines := []string{"Final standings:"}
+	for i, s := range standings {
+		lines = append(lines, fmt.Sprintf("%d. %s: score %d, %d unit(s), %d region(s)", i+1, s.Username, s.Score, s.Units, s.Regions))
+	}
+	return lines
+}
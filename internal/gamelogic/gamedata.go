@@ -1,5 +1,7 @@
 package gamelogic
 
+import "sort"
+
 type Player struct {
 	Username string
 	Units    map[int]Unit
@@ -23,11 +25,65 @@ type ArmyMove struct {
 	Player     Player
 	Units      []Unit
 	ToLocation Location
+	// Allies are the mover's allies as it last saw them, when allies fight
+	// together.
+	Allies []Player
+}
+
+func (m ArmyMove) Sender() string {
+	return m.Player.Username
+}
+
+// Spawn announces a new unit along with all of the player's units, so the
+// referee and spectators know about units that have not moved.
+type Spawn struct {
+	Player Player
+	Unit   Unit
+}
+
+func (s Spawn) Sender() string {
+	return s.Player.Username
 }
 
+// RecognitionOfWar holds everything a war is fought with, so the attacker,
+// the defender and the referee all resolve it the same way.
 type RecognitionOfWar struct {
-	Attacker Player
-	Defender Player
+	Attacker       Player
+	AttackerAllies []Player
+	Defender       Player
+	DefenderAllies []Player
+}
+
+// The defender notices the overlap and publishes the war.
+func (rw RecognitionOfWar) Sender() string {
+	return rw.Defender.Username
+}
+
+type Relation string
+
+const (
+	RelationNone     Relation = ""
+	RelationAlliance Relation = "alliance"
+	RelationPact     Relation = "pact"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyPropose DiplomacyAction = "propose"
+	DiplomacyAccept  DiplomacyAction = "accept"
+	DiplomacyBreak   DiplomacyAction = "break"
+)
+
+type DiplomacyMessage struct {
+	Action   DiplomacyAction
+	Relation Relation
+	From     string
+	To       string
+}
+
+func (dm DiplomacyMessage) Sender() string {
+	return dm.From
 }
 
 type Location string
@@ -40,6 +96,31 @@ func getAllRanks() map[UnitRank]struct{} {
 	}
 }
 
+func IsValidLocation(loc string) bool {
+	_, ok := getAllLocations()[Location(loc)]
+	return ok
+}
+
+// Locations returns the names of every region, sorted.
+func Locations() []string {
+	locations := []string{}
+	for loc := range getAllLocations() {
+		locations = append(locations, string(loc))
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+// Ranks returns the names of every unit rank, sorted.
+func Ranks() []string {
+	ranks := []string{}
+	for rank := range getAllRanks() {
+		ranks = append(ranks, string(rank))
+	}
+	sort.Strings(ranks)
+	return ranks
+}
+
 func getAllLocations() map[Location]struct{} {
 	return map[Location]struct{}{
 		"americas":   {},
@@ -7,22 +7,15 @@ import (
 	"math/rand"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logstore"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/presence"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 func PrintClientHelp() {
-	fmt.Println("Possible commands:")
-	fmt.Println("* move <location> <unitID> <unitID> <unitID>...")
-	fmt.Println("    example:")
-	fmt.Println("    move asia 1")
-	fmt.Println("* spawn <location> <rank>")
-	fmt.Println("    example:")
-	fmt.Println("    spawn europe infantry")
-	fmt.Println("* status")
-	fmt.Println("* spam <n>")
-	fmt.Println("    example:")
-	fmt.Println("    spam 5")
-	fmt.Println("* quit")
-	fmt.Println("* help")
+	ConsolePresenter{}.Present(ClientHelp{})
 }
 
 func ClientWelcome() (string, error) {
@@ -34,59 +27,127 @@ func ClientWelcome() (string, error) {
 	}
 	username := words[0]
 	fmt.Printf("Welcome, %s!\n", username)
-	PrintClientHelp()
 	return username, nil
 }
 
 func PrintServerHelp() {
 	fmt.Println("Possible commands:")
-	fmt.Println("* pause")
-	fmt.Println("* resume")
+	fmt.Println("* games")
+	fmt.Println("* players")
+	fmt.Println("* pause [gameID] [duration] [reason]")
+	fmt.Println("* pause player <name> [duration] [reason]")
+	fmt.Println("    example:")
+	fmt.Println("    pause player bob 60s \"cooling off\"")
+	fmt.Println("* pause region <location> [duration] [reason]")
+	fmt.Println("* resume [gameID]")
+	fmt.Println("* resume player <name>")
+	fmt.Println("* resume region <location>")
+	fmt.Println("* standings <gameID>")
+	fmt.Println("* mute <player>")
+	fmt.Println("* unmute <player>")
+	fmt.Println("* kick <player> [reason]")
+	fmt.Println("* ban <player> [reason]")
+	fmt.Println("* unban <player>")
+	fmt.Println("* wipe <player> [region]")
+	fmt.Println("* logs tail [n]")
+	fmt.Println("* logs search <text>")
+	fmt.Println("* logs by <player>")
+	fmt.Println("* logs since <time|duration>")
+	fmt.Println("    example:")
+	fmt.Println("    logs since 10m")
+	fmt.Println("* config print")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
+func PrintPlayers(entries []presence.Entry) {
+	ConsolePresenter{}.Present(PlayersOnline{Entries: entries})
+}
+
+func PrintLobbyHelp(spectate bool) {
+	fmt.Println("Choose a game:")
+	fmt.Println("* list")
+	if spectate {
+		fmt.Println("* watch <gameID>")
+	} else {
+		fmt.Println("* create [name]")
+		fmt.Println("* join <gameID>")
+	}
+	fmt.Println("* quit")
+}
+
+func PrintGames(games []routing.GameInfo) {
+	if len(games) == 0 {
+		fmt.Println("There are no games yet.")
+		return
+	}
+	for _, g := range games {
+		status := "playing"
+		switch {
+		case g.Over:
+			status = "over"
+		case g.Paused:
+			status = "paused"
+		}
+		fmt.Printf("* %s: %s (%s) players: %v\n", g.ID, g.Name, status, g.Players)
+	}
+}
+
+func PrintLogs(entries []logstore.Entry) {
+	if len(entries) == 0 {
+		fmt.Println("No matching log entries.")
+		return
+	}
+	for _, e := range entries {
+		game := ""
+		if e.GameID != "" {
+			game = " " + e.GameID
+		}
+		fmt.Printf("%v [%s%s] %s: %s\n", e.Time.Format(time.RFC3339), e.Event, game, e.Username, e.Message)
+	}
+}
+
+var input = bufio.NewScanner(os.Stdin)
+
 func GetInput() []string {
 	fmt.Print("> ")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanned := scanner.Scan()
+	scanned := input.Scan()
 	if !scanned {
 		return nil
 	}
-	line := scanner.Text()
+	line := input.Text()
 	line = strings.TrimSpace(line)
 	return strings.Fields(line)
 }
 
+var maliciousLogs = []string{
+	"Never interrupt your enemy when he is making a mistake.",
+	"The hardest thing of all for a soldier is to retreat.",
+	"A soldier will fight long and hard for a bit of colored ribbon.",
+	"It is well that war is so terrible, otherwise we should grow too fond of it.",
+	"The art of war is simple enough. Find out where your enemy is. Get at him as soon as you can. Strike him as hard as you can, and keep moving on.",
+	"All warfare is based on deception.",
+}
+
 func GetMaliciousLog() string {
-	possibleLogs := []string{
-		"Never interrupt your enemy when he is making a mistake.",
-		"The hardest thing of all for a soldier is to retreat.",
-		"A soldier will fight long and hard for a bit of colored ribbon.",
-		"It is well that war is so terrible, otherwise we should grow too fond of it.",
-		"The art of war is simple enough. Find out where your enemy is. Get at him as soon as you can. Strike him as hard as you can, and keep moving on.",
-		"All warfare is based on deception.",
-	}
-	randomIndex := rand.Intn(len(possibleLogs))
-	msg := possibleLogs[randomIndex]
+	randomIndex := rand.Intn(len(maliciousLogs))
+	msg := maliciousLogs[randomIndex]
 	return msg
 }
 
+// MaliciousLogs lists every quote the spam command can send.
+func MaliciousLogs() []string {
+	return append([]string{}, maliciousLogs...)
+}
+
 func PrintQuit() {
-	fmt.Println("I hate this game! (╯°□°)╯︵ ┻━┻")
+	ConsolePresenter{}.Present(Quit{})
 }
 
 func (gs *GameState) CommandStatus() {
-	if gs.isPaused() {
-		fmt.Println("The game is paused.")
-		return
-	} else {
-		fmt.Println("The game is not paused.")
-	}
-
-	p := gs.GetPlayerSnap()
-	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
-	for _, unit := range p.Units {
-		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
-	}
+	gs.present(Status{
+		Player:    gs.GetPlayerSnap(),
+		Paused:    gs.isPaused(),
+		Relations: gs.GetRelations(),
+	})
 }
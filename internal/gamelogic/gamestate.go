@@ -2,12 +2,27 @@ package gamelogic
 
 import (
 	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 type GameState struct {
 	Player Player
 	Paused bool
-	mu     *sync.RWMutex
+	// CombineAllies adds allied units in the contested region to each side's power in HandleWar.
+	CombineAllies bool
+	relations     map[string]Relation
+	proposals     map[string]Relation
+	outgoing      map[string]Relation
+	allySnaps     map[string]Player
+	// lastUnitID is the last ID CommandSpawn gave out. It only goes up.
+	lastUnitID   int
+	over         bool
+	pausedUntil  time.Time
+	scopedPauses map[string]scopedPause
+	presenter    Presenter
+	mu           *sync.RWMutex
 }
 
 func NewGameState(username string) *GameState {
@@ -16,27 +31,112 @@ func NewGameState(username string) *GameState {
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:       false,
+		relations:    map[string]Relation{},
+		proposals:    map[string]Relation{},
+		outgoing:     map[string]Relation{},
+		allySnaps:    map[string]Player{},
+		scopedPauses: map[string]scopedPause{},
+		presenter:    ConsolePresenter{},
+		mu:           &sync.RWMutex{},
 	}
 }
 
+// SetPresenter changes how the game's events are shown. It defaults to the console.
+func (gs *GameState) SetPresenter(p Presenter) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.presenter = p
+}
+
+// Present shows an event that did not come from the game, like the reply to a
+// command, the same way as the game's own events.
+func (gs *GameState) Present(e Event) {
+	gs.present(e)
+}
+
+// present must not be called with gs.mu held, as presenters may read the state.
+func (gs *GameState) present(e Event) {
+	gs.mu.RLock()
+	p := gs.presenter
+	gs.mu.RUnlock()
+	p.Present(e)
+}
+
+type scopedPause struct {
+	until  time.Time
+	reason string
+}
+
+func (p scopedPause) active(now time.Time) bool {
+	return p.until.IsZero() || now.Before(p.until)
+}
+
+func scopedPauseKey(scope routing.PauseScope, target string) string {
+	return string(scope) + ":" + target
+}
+
 func (gs *GameState) resumeGame() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
+	if gs.over {
+		return
+	}
 	gs.Paused = false
+	gs.pausedUntil = time.Time{}
 }
 
-func (gs *GameState) pauseGame() {
+func (gs *GameState) pauseGame(until time.Time) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.Paused = true
+	gs.pausedUntil = until
 }
 
-func (gs *GameState) isPaused() bool {
+func (gs *GameState) setScopedPause(scope routing.PauseScope, target string, p *scopedPause) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if p == nil {
+		delete(gs.scopedPauses, scopedPauseKey(scope, target))
+		return
+	}
+	gs.scopedPauses[scopedPauseKey(scope, target)] = *p
+}
+
+// scopedPauseFor returns the active pause on a player or region, if any.
+func (gs *GameState) scopedPauseFor(scope routing.PauseScope, target string) (scopedPause, bool) {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
-	return gs.Paused
+	p, ok := gs.scopedPauses[scopedPauseKey(scope, target)]
+	if !ok || !p.active(time.Now()) {
+		return scopedPause{}, false
+	}
+	return p, true
+}
+
+func (gs *GameState) endGame() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.over = true
+	gs.Paused = true
+	gs.pausedUntil = time.Time{}
+}
+
+func (gs *GameState) IsOver() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.over
+}
+
+func (gs *GameState) isPaused() bool {
+	gs.mu.RLock()
+	paused := gs.Paused && (gs.pausedUntil.IsZero() || time.Now().Before(gs.pausedUntil))
+	gs.mu.RUnlock()
+	if paused {
+		return true
+	}
+	_, ok := gs.scopedPauseFor(routing.PausePlayer, gs.GetUsername())
+	return ok
 }
 
 func (gs *GameState) addUnit(u Unit) {
@@ -2,31 +2,31 @@ package gamelogic
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
-const logsFile = "game.log"
-
-const writeToDiskSleep = 1 * time.Second
-
-func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
-	time.Sleep(writeToDiskSleep)
-
-	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// WriteStandings appends a finished game's result to the file at path.
+func WriteStandings(path string, gameOver routing.GameOver) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("could not open logs file: %v", err)
+		return fmt.Errorf("could not open standings file: %v", err)
 	}
 	defer f.Close()
 
-	str := fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
+	winner := gameOver.Winner
+	if winner == "" {
+		winner = "nobody"
+	}
+	str := fmt.Sprintf("%v game %v over, winner %v: %v\n", gameOver.EndTime.Format(time.RFC3339), gameOver.GameID, winner, gameOver.Reason)
+	for i, s := range gameOver.Standings {
+		str += fmt.Sprintf("  %d. %v: score %d, %d unit(s), %d region(s)\n", i+1, s.Username, s.Score, s.Units, s.Regions)
+	}
 	_, err = f.WriteString(str)
 	if err != nil {
-		return fmt.Errorf("could not write to logs file: %v", err)
+		return fmt.Errorf("could not write to standings file: %v", err)
 	}
 	return nil
 }
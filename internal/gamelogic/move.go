@@ -15,43 +15,51 @@ const (
 )
 
 func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
-	defer fmt.Println("------------------------")
-	player := gs.GetPlayerSnap()
-
-	fmt.Println()
-	fmt.Println("==== Move Detected ====")
-	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
-	for _, unit := range move.Units {
-		fmt.Printf("* %v\n", unit.Rank)
+	e := MoveDetected{Move: move, Outcome: gs.moveOutcome(move)}
+	if e.Outcome != MoveOutcomeSamePlayer {
+		e.Relation = gs.GetRelation(move.Player.Username)
 	}
+	if e.Outcome == MoveOutcomeMakeWar {
+		e.Location = OverlappingLocation(gs.GetPlayerSnap(), move.Player)
+	}
+	gs.present(e)
+	return e.Outcome
+}
 
+func (gs *GameState) moveOutcome(move ArmyMove) MoveOutcome {
+	player := gs.GetPlayerSnap()
 	if player.Username == move.Player.Username {
 		return MoveOutcomeSamePlayer
 	}
 
-	overlappingLocation := getOverlappingLocation(player, move.Player)
-	if overlappingLocation != "" {
-		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
+	if relation := gs.GetRelation(move.Player.Username); relation != RelationNone {
+		gs.recordAllySnap(move.Player)
+		return MoveOutComeSafe
+	}
+
+	if OverlappingLocation(player, move.Player) != "" {
 		return MoveOutcomeMakeWar
 	}
-	fmt.Printf("You are safe from %s's units.\n", move.Player.Username)
 	return MoveOutComeSafe
 }
 
-func getOverlappingLocation(p1 Player, p2 Player) Location {
-	for _, u1 := range p1.Units {
-		for _, u2 := range p2.Units {
-			if u1.Location == u2.Location {
-				return u1.Location
-			}
+// OverlappingLocation returns the first region, in Locations order, where
+// both players have units, so every player picks the same battlefield.
+func OverlappingLocation(p1 Player, p2 Player) Location {
+	for _, loc := range Locations() {
+		if len(unitsInLocation(p1, Location(loc))) > 0 && len(unitsInLocation(p2, Location(loc))) > 0 {
+			return Location(loc)
 		}
 	}
 	return ""
 }
 
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
-	if gs.isPaused() {
-		return ArmyMove{}, errors.New("the game is paused, you can not move units")
+	if gs.IsOver() {
+		return ArmyMove{}, errors.New("the game is over, you can not move units")
+	}
+	if err := gs.checkPaused("move units"); err != nil {
+		return ArmyMove{}, err
 	}
 	if len(words) < 3 {
 		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
@@ -71,12 +79,21 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		unitIDs = append(unitIDs, unitID)
 	}
 
-	newUnits := []Unit{}
+	regions := []Location{newLocation}
 	for _, unitID := range unitIDs {
 		unit, ok := gs.GetUnit(unitID)
 		if !ok {
 			return ArmyMove{}, fmt.Errorf("error: unit with ID %v not found", unitID)
 		}
+		regions = append(regions, unit.Location)
+	}
+	if err := gs.checkPaused("move units", regions...); err != nil {
+		return ArmyMove{}, err
+	}
+
+	newUnits := []Unit{}
+	for _, unitID := range unitIDs {
+		unit, _ := gs.GetUnit(unitID)
 		unit.Location = newLocation
 		gs.UpdateUnit(unit)
 		newUnits = append(newUnits, unit)
@@ -87,6 +104,9 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		Units:      newUnits,
 		Player:     gs.GetPlayerSnap(),
 	}
-	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
+	if gs.CombineAllies {
+		mv.Allies = gs.GetAllySnaps()
+	}
+	gs.present(UnitsMoved{Move: mv})
 	return mv, nil
 }
@@ -1,19 +1,86 @@
 package gamelogic
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 func (gs *GameState) HandlePause(ps routing.PlayingState) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
-	if ps.IsPaused {
-		fmt.Println("==== Pause Detected ====")
-		gs.pauseGame()
-	} else {
-		fmt.Println("==== Resume Detected ====")
-		gs.resumeGame()
+	var until time.Time
+	if ps.Duration > 0 {
+		until = time.Now().Add(ps.Duration)
 	}
+
+	switch ps.Scope {
+	case routing.PausePlayer, routing.PauseRegion:
+		if ps.IsPaused {
+			gs.setScopedPause(ps.Scope, ps.Target, &scopedPause{until: until, reason: ps.Reason})
+		} else {
+			gs.setScopedPause(ps.Scope, ps.Target, nil)
+		}
+	default:
+		if ps.IsPaused {
+			gs.pauseGame(until)
+		} else if gs.IsOver() {
+			gs.present(PauseChanged{State: ps, Ignored: true})
+			return
+		} else {
+			gs.resumeGame()
+		}
+	}
+	gs.present(PauseChanged{State: ps})
+}
+
+// PauseStatus describes what is paused for this player, or "" if nothing is.
+func (gs *GameState) PauseStatus() string {
+	if gs.IsOver() {
+		return "game over"
+	}
+	if p, ok := gs.scopedPauseFor(routing.PausePlayer, gs.GetUsername()); ok {
+		return pausedError("you are paused", p).Error()
+	}
+	if gs.isPaused() {
+		return "the game is paused"
+	}
+	regions := []string{}
+	for _, loc := range Locations() {
+		if _, ok := gs.scopedPauseFor(routing.PauseRegion, loc); ok {
+			regions = append(regions, loc)
+		}
+	}
+	if len(regions) > 0 {
+		return "paused regions: " + strings.Join(regions, ", ")
+	}
+	return ""
+}
+
+// checkPaused returns an error if the player, the whole game, or any of the
+// given regions is paused.
+func (gs *GameState) checkPaused(action string, locations ...Location) error {
+	if p, ok := gs.scopedPauseFor(routing.PausePlayer, gs.GetUsername()); ok {
+		return pausedError(fmt.Sprintf("you are paused, you can not %s", action), p)
+	}
+	if gs.isPaused() {
+		return fmt.Errorf("the game is paused, you can not %s", action)
+	}
+	for _, loc := range locations {
+		if p, ok := gs.scopedPauseFor(routing.PauseRegion, string(loc)); ok {
+			return pausedError(fmt.Sprintf("%s is paused, you can not %s", loc, action), p)
+		}
+	}
+	return nil
+}
+
+func pausedError(msg string, p scopedPause) error {
+	if !p.until.IsZero() {
+		msg += fmt.Sprintf(" for another %v", time.Until(p.until).Round(time.Second))
+	}
+	if p.reason != "" {
+		msg += ": " + p.reason
+	}
+	return errors.New(msg)
 }
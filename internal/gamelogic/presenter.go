@@ -0,0 +1,122 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Presenter shows the events a GameState or Spectator emits.
+type Presenter interface {
+	Present(e Event)
+}
+
+// PresenterFunc lets a plain function be used as a Presenter.
+type PresenterFunc func(e Event)
+
+func (f PresenterFunc) Present(e Event) {
+	f(e)
+}
+
+// ConsolePresenter prints events as text for the REPL.
+type ConsolePresenter struct {
+	// Writer defaults to whatever os.Stdout is when an event is shown.
+	Writer io.Writer
+}
+
+func (c ConsolePresenter) Present(e Event) {
+	w := c.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	switch e := e.(type) {
+	case ChatReceived, FeedItem:
+		// These arrive while the player is typing, so clear the "> " first.
+		for _, line := range e.Lines() {
+			fmt.Fprintf(w, "\r\033[2K%s\n", line)
+		}
+	case titled:
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "==== %s ====\n", e.Title())
+		for _, line := range e.Lines() {
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintln(w, "------------------------")
+	default:
+		for _, line := range e.Lines() {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// JSONPresenter writes one JSON object per event, with its type, text and data.
+type JSONPresenter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func NewJSONPresenter(w io.Writer) *JSONPresenter {
+	return &JSONPresenter{
+		w:  w,
+		mu: &sync.Mutex{},
+	}
+}
+
+type jsonEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Title string    `json:"title,omitempty"`
+	Lines []string  `json:"lines"`
+	Data  Event     `json:"data"`
+}
+
+func (j *JSONPresenter) Present(e Event) {
+	out := jsonEvent{
+		Event: reflect.TypeOf(e).Name(),
+		Time:  time.Now(),
+		Lines: e.Lines(),
+		Data:  e,
+	}
+	if t, ok := e.(titled); ok {
+		out.Title = t.Title()
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		data, _ = json.Marshal(jsonEvent{Event: out.Event, Time: out.Time, Lines: []string{err.Error()}})
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.w.Write(append(data, '\n'))
+}
+
+// SilentPresenter drops every event, for bots and simulations.
+type SilentPresenter struct{}
+
+func (SilentPresenter) Present(Event) {}
+
+// NewPresenter returns the console, json or silent presenter.
+func NewPresenter(name string, w io.Writer) (Presenter, error) {
+	switch name {
+	case "console":
+		return ConsolePresenter{Writer: w}, nil
+	case "json":
+		return NewJSONPresenter(w), nil
+	case "silent":
+		return SilentPresenter{}, nil
+	}
+	return nil, fmt.Errorf("unknown presenter %q, choose console, json or silent", name)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
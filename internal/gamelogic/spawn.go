@@ -5,30 +5,53 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+// CommandSpawn adds a unit and returns the spawn to announce to the game.
+func (gs *GameState) CommandSpawn(words []string) (Spawn, error) {
+	if gs.IsOver() {
+		return Spawn{}, errors.New("the game is over, you can not spawn units")
+	}
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return Spawn{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return Spawn{}, fmt.Errorf("error: %s is not a valid location", locationName)
+	}
+
+	if err := gs.checkPaused("spawn units", Location(locationName)); err != nil {
+		return Spawn{}, err
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return Spawn{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
-		ID:       id,
+	unit := Unit{
+		ID:       gs.nextUnitID(),
 		Rank:     UnitRank(rank),
 		Location: Location(locationName),
-	})
+	}
+	gs.addUnit(unit)
 
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	gs.present(UnitSpawned{Unit: unit})
+	return Spawn{Player: gs.GetPlayerSnap(), Unit: unit}, nil
+}
+
+// nextUnitID never gives out an ID twice, even once the units that had the
+// highest IDs have been lost, so other players never mistake a new unit for
+// one they saw before.
+func (gs *GameState) nextUnitID() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for id := range gs.Player.Units {
+		if id > gs.lastUnitID {
+			gs.lastUnitID = id
+		}
+	}
+	gs.lastUnitID++
+	return gs.lastUnitID
 }
@@ -0,0 +1,141 @@
+package gamelogic
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Spectator follows a game from the messages its players publish. Its board
+// is a referee with no victory conditions, so wars, treaties and wipes change
+// it exactly as they change the server's.
+type Spectator struct {
+	GameID    string
+	board     *Referee
+	paused    bool
+	over      bool
+	presenter Presenter
+	mu        *sync.RWMutex
+}
+
+func NewSpectator(gameID string, combineAllies bool) *Spectator {
+	board := NewReferee(VictoryConditions{})
+	board.CombineAllies = combineAllies
+	return &Spectator{
+		GameID:    gameID,
+		board:     board,
+		presenter: ConsolePresenter{},
+		mu:        &sync.RWMutex{},
+	}
+}
+
+func (s *Spectator) SetPresenter(p Presenter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presenter = p
+}
+
+func (s *Spectator) HandleSpawn(spawn Spawn) {
+	s.board.HandleSpawn(spawn)
+	s.feed("%s spawned %s #%d in %s", spawn.Player.Username, spawn.Unit.Rank, spawn.Unit.ID, spawn.Unit.Location)
+}
+
+func (s *Spectator) HandleMove(move ArmyMove) {
+	s.board.HandleMove(move)
+
+	units := []string{}
+	for _, unit := range move.Units {
+		units = append(units, fmt.Sprintf("%s #%d", unit.Rank, unit.ID))
+	}
+	s.feed("%s moved %s to %s", move.Player.Username, strings.Join(units, ", "), move.ToLocation)
+}
+
+func (s *Spectator) HandleWar(rw RecognitionOfWar) {
+	s.board.HandleWar(rw)
+	s.feed("%s and %s are at war", rw.Attacker.Username, rw.Defender.Username)
+}
+
+func (s *Spectator) HandleDiplomacy(dm DiplomacyMessage) {
+	s.board.HandleDiplomacy(dm)
+}
+
+func (s *Spectator) HandleWipe(w routing.Wipe) {
+	s.board.HandleWipe(w)
+	if w.Region != "" {
+		s.feed("%s's units in %s were removed", w.Target, w.Region)
+	} else {
+		s.feed("%s's units were removed", w.Target)
+	}
+}
+
+func (s *Spectator) HandleLog(gl routing.GameLog) {
+	s.feed("%s: %s", gl.Username, gl.Message)
+}
+
+func (s *Spectator) HandlePause(ps routing.PlayingState) {
+	target := ""
+	if ps.Scope != "" {
+		target = fmt.Sprintf(" (%s %s)", ps.Scope, ps.Target)
+	}
+	if ps.Scope == "" {
+		s.mu.Lock()
+		s.paused = ps.IsPaused
+		s.mu.Unlock()
+	}
+	if ps.IsPaused {
+		s.feed("the game was paused%s", target)
+	} else {
+		s.feed("the game was resumed%s", target)
+	}
+}
+
+func (s *Spectator) HandleGameOver(gameOver routing.GameOver) {
+	s.mu.Lock()
+	s.over = true
+	s.mu.Unlock()
+	s.present(GameEnded{GameOver: gameOver})
+}
+
+// PrintBoard shows how many units each player is known to have per region.
+func (s *Spectator) PrintBoard() {
+	s.mu.RLock()
+	board := Board{
+		GameID: s.GameID,
+		Over:   s.over,
+		Paused: s.paused,
+		Units:  map[string]map[string]int{},
+	}
+	s.mu.RUnlock()
+	for username, p := range s.board.snapshot() {
+		for _, loc := range Locations() {
+			if board.Units[loc] == nil {
+				board.Units[loc] = map[string]int{}
+			}
+			if n := len(unitsInLocation(p, Location(loc))); n > 0 {
+				board.Units[loc][username] = n
+			}
+		}
+	}
+	s.present(board)
+}
+
+func PrintSpectatorHelp() {
+	fmt.Println("You are spectating, possible commands:")
+	fmt.Println("* board")
+	fmt.Println("* help")
+	fmt.Println("* quit")
+}
+
+func (s *Spectator) present(e Event) {
+	s.mu.RLock()
+	p := s.presenter
+	s.mu.RUnlock()
+	p.Present(e)
+}
+
+func (s *Spectator) feed(format string, args ...interface{}) {
+	s.present(FeedItem{Time: time.Now(), Text: fmt.Sprintf(format, args...)})
+}
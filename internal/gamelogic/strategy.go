@@ -0,0 +1,211 @@
+package gamelogic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// StrategyMaxUnits is how many units the built-in strategies build up to.
+const StrategyMaxUnits = 10
+
+// Strategy decides what a computer player does next.
+type Strategy interface {
+	Name() string
+	// Observe is called with the latest snapshot of another player, from the
+	// moves and wars the bot sees.
+	Observe(p Player)
+	// Next returns the next command as the words a player would type, or nil
+	// to do nothing this turn.
+	Next(gs *GameState) []string
+}
+
+// StrategyNames lists the built-in strategies.
+func StrategyNames() []string {
+	return []string{"random", "aggressive", "defensive"}
+}
+
+func NewStrategy(name string, rng *rand.Rand) (Strategy, error) {
+	base := strategyBase{rng: rng, opponents: newOpponents()}
+	switch name {
+	case "random":
+		return &randomStrategy{base}, nil
+	case "aggressive":
+		return &aggressiveStrategy{base}, nil
+	case "defensive":
+		return &defensiveStrategy{strategyBase: base}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q, choose one of %v", name, StrategyNames())
+}
+
+type strategyBase struct {
+	rng       *rand.Rand
+	opponents *opponents
+}
+
+func (s strategyBase) Observe(p Player) {
+	s.opponents.observe(p)
+}
+
+func (s strategyBase) randomLocation() string {
+	locations := Locations()
+	return locations[s.rng.Intn(len(locations))]
+}
+
+func (s strategyBase) randomRank() string {
+	ranks := Ranks()
+	return ranks[s.rng.Intn(len(ranks))]
+}
+
+// opponents remembers where the other players' units were last seen.
+type opponents struct {
+	players map[string]Player
+	mu      *sync.Mutex
+}
+
+func newOpponents() *opponents {
+	return &opponents{
+		players: map[string]Player{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (o *opponents) observe(p Player) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.players[p.Username] = p
+}
+
+// powerByLocation sums the power of every enemy of gs in each region,
+// ignoring allies and pact partners.
+func (o *opponents) powerByLocation(gs *GameState) map[string]int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	power := map[string]int{}
+	for username, p := range o.players {
+		if gs.GetRelation(username) != RelationNone {
+			continue
+		}
+		for _, loc := range Locations() {
+			power[loc] += unitsToPowerLevel(unitsInLocation(p, Location(loc)))
+		}
+	}
+	return power
+}
+
+// moveCommand moves every unit not already there to loc, or returns nil.
+func moveCommand(units []Unit, loc string) []string {
+	words := []string{"move", loc}
+	for _, unit := range units {
+		if string(unit.Location) != loc {
+			words = append(words, strconv.Itoa(unit.ID))
+		}
+	}
+	if len(words) == 2 {
+		return nil
+	}
+	return words
+}
+
+func sortedUnits(p Player) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	return units
+}
+
+// randomStrategy spawns and moves units at random.
+type randomStrategy struct {
+	strategyBase
+}
+
+func (s *randomStrategy) Name() string {
+	return "random"
+}
+
+func (s *randomStrategy) Next(gs *GameState) []string {
+	units := sortedUnits(gs.GetPlayerSnap())
+	if len(units) == 0 || (len(units) < StrategyMaxUnits && s.rng.Intn(2) == 0) {
+		return []string{"spawn", s.randomLocation(), s.randomRank()}
+	}
+	unit := units[s.rng.Intn(len(units))]
+	loc := s.randomLocation()
+	if loc == string(unit.Location) {
+		return nil
+	}
+	return []string{"move", loc, strconv.Itoa(unit.ID)}
+}
+
+// aggressiveStrategy builds artillery, then throws its whole army at the
+// strongest enemy stack it can beat.
+type aggressiveStrategy struct {
+	strategyBase
+}
+
+func (s *aggressiveStrategy) Name() string {
+	return "aggressive"
+}
+
+func (s *aggressiveStrategy) Next(gs *GameState) []string {
+	units := sortedUnits(gs.GetPlayerSnap())
+	if len(units) < 3 {
+		return []string{"spawn", s.randomLocation(), RankArtillery}
+	}
+
+	myPower := unitsToPowerLevel(units)
+	target, targetPower := "", 0
+	for loc, power := range s.opponents.powerByLocation(gs) {
+		if power > 0 && power < myPower && (power > targetPower || (power == targetPower && loc < target)) {
+			target, targetPower = loc, power
+		}
+	}
+	if target != "" {
+		if words := moveCommand(units, target); words != nil {
+			return words
+		}
+	}
+	if len(units) < StrategyMaxUnits {
+		return []string{"spawn", string(units[0].Location), RankArtillery}
+	}
+	// Nobody to beat that we know of, so go looking.
+	return moveCommand(units, s.randomLocation())
+}
+
+// defensiveStrategy picks the quietest region, fills it with its strongest
+// units and never leaves.
+type defensiveStrategy struct {
+	strategyBase
+	home string
+}
+
+func (s *defensiveStrategy) Name() string {
+	return "defensive"
+}
+
+func (s *defensiveStrategy) Next(gs *GameState) []string {
+	if s.home == "" {
+		power := s.opponents.powerByLocation(gs)
+		for _, loc := range Locations() {
+			if s.home == "" || power[loc] < power[s.home] {
+				s.home = loc
+			}
+		}
+	}
+
+	units := sortedUnits(gs.GetPlayerSnap())
+	if words := moveCommand(units, s.home); words != nil {
+		return words
+	}
+	if len(units) < StrategyMaxUnits {
+		rank := RankArtillery
+		if len(units)%2 == 1 {
+			rank = RankCavalry
+		}
+		return []string{"spawn", s.home, rank}
+	}
+	return nil
+}
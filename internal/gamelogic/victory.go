@@ -0,0 +1,304 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type VictoryConditions struct {
+	// ControlRegions and ControlTurns: a player wins by holding at least
+	// ControlRegions regions alone for ControlTurns consecutive turns.
+	ControlRegions     int
+	ControlTurns       int
+	EliminateOpponents bool
+	// TimeLimit ends the game in favour of the highest score.
+	TimeLimit time.Duration
+}
+
+func (vc VictoryConditions) String() string {
+	conditions := []string{}
+	if vc.ControlRegions > 0 {
+		conditions = append(conditions, fmt.Sprintf("control %d region(s) for %d turn(s)", vc.ControlRegions, vc.ControlTurns))
+	}
+	if vc.EliminateOpponents {
+		conditions = append(conditions, "eliminate all opponents")
+	}
+	if vc.TimeLimit > 0 {
+		conditions = append(conditions, fmt.Sprintf("highest score after %v", vc.TimeLimit))
+	}
+	if len(conditions) == 0 {
+		return "none"
+	}
+	return strings.Join(conditions, ", ")
+}
+
+// Referee mirrors every player's units from the spawns, moves and wars it
+// observes and decides when the game has been won. A turn is one observed
+// army move.
+type Referee struct {
+	Conditions    VictoryConditions
+	CombineAllies bool
+	// OnWar, if set, is told the power on each side of every war refereed.
+	OnWar     func(attackerPower, defenderPower int)
+	players   map[string]Player
+	relations map[string]map[string]Relation
+	// proposals are the treaties each player has offered and is waiting on,
+	// like GameState's outgoing.
+	proposals    map[string]map[string]Relation
+	controlTurns map[string]int
+	over         bool
+	mu           *sync.Mutex
+}
+
+func NewReferee(conditions VictoryConditions) *Referee {
+	return &Referee{
+		Conditions:   conditions,
+		players:      map[string]Player{},
+		relations:    map[string]map[string]Relation{},
+		proposals:    map[string]map[string]Relation{},
+		controlTurns: map[string]int{},
+		mu:           &sync.Mutex{},
+	}
+}
+
+func (r *Referee) HandleMove(move ArmyMove) (routing.GameOver, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.over {
+		return routing.GameOver{}, false
+	}
+	r.players[move.Player.Username] = move.Player
+
+	if r.Conditions.ControlRegions <= 0 {
+		return routing.GameOver{}, false
+	}
+	for username := range r.players {
+		if r.regionsControlled(username) >= r.Conditions.ControlRegions {
+			r.controlTurns[username]++
+		} else {
+			r.controlTurns[username] = 0
+		}
+	}
+	for username, turns := range r.controlTurns {
+		if turns >= r.Conditions.ControlTurns {
+			reason := fmt.Sprintf("%s controlled %d region(s) for %d turn(s)", username, r.Conditions.ControlRegions, turns)
+			return r.endGame(username, reason), true
+		}
+	}
+	return routing.GameOver{}, false
+}
+
+// HandleSpawn records a player's units after a spawn, so players who have
+// not moved yet are known too.
+func (r *Referee) HandleSpawn(spawn Spawn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.over {
+		return
+	}
+	r.players[spawn.Player.Username] = spawn.Player
+}
+
+func (r *Referee) HandleWar(rw RecognitionOfWar) (routing.GameOver, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.over {
+		return routing.GameOver{}, false
+	}
+	if r.relations[rw.Attacker.Username][rw.Defender.Username] != RelationNone {
+		return routing.GameOver{}, false
+	}
+
+	b := fight(rw, r.CombineAllies)
+	if b.location == "" {
+		return routing.GameOver{}, false
+	}
+	if r.OnWar != nil {
+		r.OnWar(b.attackerPower, b.defenderPower)
+	}
+	// The players remove their units from their state as it is now, which
+	// for the attacker may be newer than the recognition.
+	attacker, ok := r.players[rw.Attacker.Username]
+	if !ok {
+		attacker = rw.Attacker
+	}
+	r.players[rw.Attacker.Username] = attacker
+	r.players[rw.Defender.Username] = rw.Defender
+	if b.draw || b.loser == rw.Defender.Username {
+		r.players[rw.Defender.Username] = withoutUnitsInLocation(rw.Defender, b.location)
+	}
+	if b.draw || b.loser == rw.Attacker.Username {
+		r.players[rw.Attacker.Username] = withoutUnitsInLocation(attacker, b.location)
+	}
+
+	if !r.Conditions.EliminateOpponents || len(r.players) < 2 {
+		return routing.GameOver{}, false
+	}
+	survivors := []string{}
+	for username, p := range r.players {
+		if len(p.Units) > 0 {
+			survivors = append(survivors, username)
+		}
+	}
+	if len(survivors) != 1 {
+		return routing.GameOver{}, false
+	}
+	return r.endGame(survivors[0], fmt.Sprintf("%s eliminated all opponents", survivors[0])), true
+}
+
+// HandleDiplomacy records treaties as the players do, so an acceptance of
+// something that was never proposed is ignored.
+func (r *Referee) HandleDiplomacy(dm DiplomacyMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch dm.Action {
+	case DiplomacyPropose:
+		if _, ok := r.proposals[dm.From]; !ok {
+			r.proposals[dm.From] = map[string]Relation{}
+		}
+		r.proposals[dm.From][dm.To] = dm.Relation
+	case DiplomacyAccept:
+		if relation, ok := r.proposals[dm.To][dm.From]; !ok || relation != dm.Relation {
+			return
+		}
+		delete(r.proposals[dm.To], dm.From)
+		r.setRelation(dm.From, dm.To, dm.Relation)
+		r.setRelation(dm.To, dm.From, dm.Relation)
+	case DiplomacyBreak:
+		delete(r.proposals[dm.From], dm.To)
+		delete(r.proposals[dm.To], dm.From)
+		r.setRelation(dm.From, dm.To, RelationNone)
+		r.setRelation(dm.To, dm.From, RelationNone)
+	}
+}
+
+// TimeUp ends the game in favour of the highest score, if it has a time limit.
+func (r *Referee) TimeUp() (routing.GameOver, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.over || r.Conditions.TimeLimit <= 0 {
+		return routing.GameOver{}, false
+	}
+	standings := r.standings()
+	if len(standings) == 0 {
+		return r.endGame("", "time limit reached with no players"), true
+	}
+	winner := standings[0].Username
+	if len(standings) > 1 && standings[1].Score == standings[0].Score {
+		winner = ""
+	}
+	return r.endGame(winner, fmt.Sprintf("time limit of %v reached", r.Conditions.TimeLimit)), true
+}
+
+func (r *Referee) IsOver() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.over
+}
+
+func (r *Referee) Standings() []routing.Standing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.standings()
+}
+
+// snapshot is every player's units as the referee knows them.
+func (r *Referee) snapshot() map[string]Player {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	players := map[string]Player{}
+	for username, p := range r.players {
+		players[username] = p
+	}
+	return players
+}
+
+func (r *Referee) setRelation(from, to string, relation Relation) {
+	if _, ok := r.relations[from]; !ok {
+		r.relations[from] = map[string]Relation{}
+	}
+	if relation == RelationNone {
+		delete(r.relations[from], to)
+		return
+	}
+	r.relations[from][to] = relation
+}
+
+func (r *Referee) endGame(winner, reason string) routing.GameOver {
+	r.over = true
+	return routing.GameOver{
+		Winner:    winner,
+		Reason:    reason,
+		EndTime:   time.Now(),
+		Standings: r.standings(),
+	}
+}
+
+func (r *Referee) regionsControlled(username string) int {
+	regions := 0
+	for loc := range getAllLocations() {
+		if len(unitsInLocation(r.players[username], loc)) == 0 {
+			continue
+		}
+		contested := false
+		for other, p := range r.players {
+			if other != username && len(unitsInLocation(p, loc)) > 0 {
+				contested = true
+				break
+			}
+		}
+		if !contested {
+			regions++
+		}
+	}
+	return regions
+}
+
+func (r *Referee) standings() []routing.Standing {
+	standings := []routing.Standing{}
+	for username, p := range r.players {
+		units := []Unit{}
+		for _, unit := range p.Units {
+			units = append(units, unit)
+		}
+		standings = append(standings, routing.Standing{
+			Username: username,
+			Units:    len(units),
+			Regions:  r.regionsControlled(username),
+			Score:    unitsToPowerLevel(units),
+		})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	return standings
+}
+
+func withoutUnitsInLocation(p Player, loc Location) Player {
+	units := map[int]Unit{}
+	for id, unit := range p.Units {
+		if unit.Location != loc {
+			units[id] = unit
+		}
+	}
+	return Player{Username: p.Username, Units: units}
+}
+
+func (gs *GameState) HandleGameOver(gameOver routing.GameOver) {
+	gs.endGame()
+	gs.present(GameEnded{GameOver: gameOver, Player: gs.GetUsername()})
+}
+
+func PrintStandings(standings []routing.Standing) {
+	for _, line := range standingsLines(standings) {
+		fmt.Println(line)
+	}
+}
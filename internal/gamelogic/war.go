@@ -1,9 +1,5 @@
 package gamelogic
 
-import (
-	"fmt"
-)
-
 type WarOutcome int
 
 const (
@@ -12,80 +8,128 @@ const (
 	WarOutcomeYouWon
 	WarOutcomeOpponentWon
 	WarOutcomeDraw
+	WarOutcomeAllied
 )
 
+// HandleWar resolves a war from the shared war queue. Only the attacker
+// resolves it there; the defender resolved its side in DefendWar when it
+// recognised the war.
 func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
-	fmt.Println("==== War Declared ====")
-	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
+	e := WarResolved{War: rw, Player: gs.GetUsername()}
+	if e.Player == rw.Attacker.Username {
+		e = gs.resolveWar(rw, rw.Defender.Username)
+	}
+	gs.present(e)
+	return e.Outcome, e.Winner, e.Loser
+}
 
-	player := gs.GetPlayerSnap()
+// RecognizeWar is the war a move starts against this player, who publishes it.
+func (gs *GameState) RecognizeWar(move ArmyMove) RecognitionOfWar {
+	return RecognitionOfWar{
+		Attacker:       move.Player,
+		AttackerAllies: move.Allies,
+		Defender:       gs.GetPlayerSnap(),
+		DefenderAllies: gs.GetAllySnaps(),
+	}
+}
 
-	if player.Username == rw.Defender.Username {
-		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+// DefendWar resolves the defender's side of a war it recognised, once the
+// recognition is published.
+func (gs *GameState) DefendWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
+	e := WarResolved{War: rw, Player: gs.GetUsername()}
+	if e.Player == rw.Defender.Username {
+		e = gs.resolveWar(rw, rw.Attacker.Username)
 	}
+	gs.present(e)
+	return e.Outcome, e.Winner, e.Loser
+}
 
-	if player.Username != rw.Attacker.Username {
-		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+// resolveWar fights the war for one side, removing this player's units in the
+// battle region if they lost or drew.
+func (gs *GameState) resolveWar(rw RecognitionOfWar, opponent string) WarResolved {
+	e := WarResolved{War: rw, Player: gs.GetUsername()}
+	if relation := gs.GetRelation(opponent); relation != RelationNone {
+		e.Outcome, e.Relation = WarOutcomeAllied, relation
+		return e
 	}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
-	if overlappingLocation == "" {
-		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+	b := fight(rw, gs.CombineAllies)
+	if b.location == "" {
+		e.Outcome = WarOutcomeNoUnits
+		return e
+	}
+	e.Location = b.location
+	e.AttackerUnits, e.DefenderUnits = b.attackerUnits, b.defenderUnits
+	e.AttackerPower, e.DefenderPower = b.attackerPower, b.defenderPower
+	e.Winner, e.Loser = b.winner, b.loser
+	switch {
+	case b.draw:
+		gs.removeUnitsInLocation(b.location)
+		e.Outcome = WarOutcomeDraw
+	case b.winner == e.Player:
+		e.Outcome = WarOutcomeYouWon
+	default:
+		gs.removeUnitsInLocation(b.location)
+		e.Outcome = WarOutcomeOpponentWon
 	}
+	return e
+}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
+type battle struct {
+	location      Location
+	attackerUnits []Unit
+	defenderUnits []Unit
+	attackerPower int
+	defenderPower int
+	// winner and loser are the attacker and defender in a draw.
+	winner string
+	loser  string
+	draw   bool
+}
+
+// fight works out a war from the recognition alone. Nobody's current state
+// goes in, so everyone who resolves it gets the same result.
+func fight(rw RecognitionOfWar, combineAllies bool) battle {
+	b := battle{location: OverlappingLocation(rw.Attacker, rw.Defender)}
+	if b.location == "" {
+		return b
 	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
+	b.attackerUnits = unitsInLocation(rw.Attacker, b.location)
+	b.defenderUnits = unitsInLocation(rw.Defender, b.location)
+	if combineAllies {
+		for _, ally := range rw.AttackerAllies {
+			b.attackerUnits = append(b.attackerUnits, unitsInLocation(ally, b.location)...)
+		}
+		for _, ally := range rw.DefenderAllies {
+			b.defenderUnits = append(b.defenderUnits, unitsInLocation(ally, b.location)...)
 		}
 	}
+	b.attackerPower = unitsToPowerLevel(b.attackerUnits)
+	b.defenderPower = unitsToPowerLevel(b.defenderUnits)
 
-	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
+	b.winner, b.loser = rw.Attacker.Username, rw.Defender.Username
+	switch {
+	case b.defenderPower > b.attackerPower:
+		b.winner, b.loser = b.loser, b.winner
+	case b.defenderPower == b.attackerPower:
+		b.draw = true
 	}
-	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
-	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
-		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
-		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
-	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
-		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
+	return b
+}
+
+func unitsInLocation(p Player, loc Location) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		if unit.Location == loc {
+			units = append(units, unit)
 		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	return units
+}
+
+// PowerIn is the player's power level in a region.
+func (p Player) PowerIn(loc Location) int {
+	return unitsToPowerLevel(unitsInLocation(p, loc))
 }
 
 func unitsToPowerLevel(units []Unit) int {
@@ -0,0 +1,293 @@
+package logstore
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime names rotated files, so they sort oldest first.
+const backupTime = "20060102T150405.000"
+
+// FsyncPolicy says when the text log is flushed to disk.
+type FsyncPolicy struct {
+	Never bool
+	// Every syncs at most this often; 0 syncs after every batch.
+	Every time.Duration
+}
+
+// ParseFsyncPolicy reads "never", "batch" or a duration like 1s.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch s {
+	case "never":
+		return FsyncPolicy{Never: true}, nil
+	case "batch":
+		return FsyncPolicy{}, nil
+	}
+	every, err := time.ParseDuration(s)
+	if err != nil || every <= 0 {
+		return FsyncPolicy{}, fmt.Errorf("fsync policy %q is not never, batch or a duration", s)
+	}
+	return FsyncPolicy{Every: every}, nil
+}
+
+type RotateConfig struct {
+	Path string
+	// MaxSize rotates before a write would take the file past this many
+	// bytes (0 never rotates on size).
+	MaxSize int64
+	// Every rotates the first time the file is written in a new period, like
+	// each day for 24h (0 never rotates on time).
+	Every time.Duration
+	// MaxBackups and MaxAge limit how many rotated files are kept and for
+	// how long (0 keeps them all).
+	MaxBackups int
+	MaxAge     time.Duration
+	Compress   bool
+	Fsync      FsyncPolicy
+}
+
+// RotatingFile appends entries to a plain-text log, one line each, in the
+// format game.log has always used. Servers sharing the file take turns
+// through a lock file, and whichever finds it due rotates it for everyone.
+type RotatingFile struct {
+	cfg      RotateConfig
+	f        *os.File
+	lock     *os.File
+	lastSync time.Time
+	// rotated hands backups to tidy, which compresses and prunes them one at
+	// a time, so a prune never deletes a file mid-compression.
+	rotated chan string
+	stopped chan struct{}
+	mu      *sync.Mutex
+}
+
+func OpenRotating(cfg RotateConfig) (*RotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(cfg.Path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create logs directory: %v", err)
+	}
+	lock, err := os.OpenFile(cfg.Path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open logs lock file: %v", err)
+	}
+	r := &RotatingFile{
+		cfg:     cfg,
+		lock:    lock,
+		rotated: make(chan string, 16),
+		stopped: make(chan struct{}),
+		mu:      &sync.Mutex{},
+	}
+	err = r.open()
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	go r.tidy()
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	r.f = f
+	return nil
+}
+
+func (r *RotatingFile) WriteEntries(entries []Entry) error {
+	var sb strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "%v %v: %v\n", e.Time.Format(time.RFC3339), e.Username, e.Message)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := lockFile(r.lock)
+	if err != nil {
+		return fmt.Errorf("could not lock logs file: %v", err)
+	}
+	defer unlockFile(r.lock)
+
+	err = r.reopenIfMoved()
+	if err != nil {
+		return err
+	}
+	info, err := r.f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	if r.due(info, int64(sb.Len())) {
+		err = r.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = r.f.WriteString(sb.String())
+	if err != nil {
+		return fmt.Errorf("could not write to logs file: %v", err)
+	}
+	if !r.cfg.Fsync.Never && time.Since(r.lastSync) >= r.cfg.Fsync.Every {
+		r.lastSync = time.Now()
+		return r.f.Sync()
+	}
+	return nil
+}
+
+// reopenIfMoved follows the path after another server rotates the file.
+func (r *RotatingFile) reopenIfMoved() error {
+	current, err := os.Stat(r.cfg.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	open, err := r.f.Stat()
+	if err == nil && current != nil && os.SameFile(current, open) {
+		return nil
+	}
+	r.f.Close()
+	return r.open()
+}
+
+func (r *RotatingFile) due(info os.FileInfo, adding int64) bool {
+	if info.Size() == 0 {
+		return false
+	}
+	if r.cfg.MaxSize > 0 && info.Size()+adding > r.cfg.MaxSize {
+		return true
+	}
+	return r.cfg.Every > 0 && info.ModTime().Truncate(r.cfg.Every).Before(time.Now().Truncate(r.cfg.Every))
+}
+
+// rotate moves the file aside and starts a new one, leaving the backup for
+// tidy to compress and prune in the background.
+func (r *RotatingFile) rotate() error {
+	if !r.cfg.Fsync.Never {
+		r.f.Sync()
+	}
+	r.f.Close()
+	backup := fmt.Sprintf("%s.%s", r.cfg.Path, time.Now().UTC().Format(backupTime))
+	err := os.Rename(r.cfg.Path, backup)
+	if err != nil {
+		return fmt.Errorf("could not rotate logs file: %v", err)
+	}
+	err = r.open()
+	if err != nil {
+		return err
+	}
+
+	r.rotated <- backup
+	return nil
+}
+
+func (r *RotatingFile) tidy() {
+	defer close(r.stopped)
+	for backup := range r.rotated {
+		if r.cfg.Compress {
+			err := compress(backup)
+			if err != nil {
+				log.Printf("Error compressing %s: %v", backup, err)
+			}
+		}
+		r.prune()
+	}
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err != nil {
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(out.Name(), path+".gz")
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune deletes the backups beyond MaxBackups or older than MaxAge. A backup
+// another server is still compressing is there both plain and as .gz, and
+// counts once.
+func (r *RotatingFile) prune() {
+	if r.cfg.MaxBackups == 0 && r.cfg.MaxAge == 0 {
+		return
+	}
+	matches, err := filepath.Glob(r.cfg.Path + ".*")
+	if err != nil {
+		log.Printf("Error listing log backups: %v", err)
+		return
+	}
+	files := map[string][]string{}
+	for _, m := range matches {
+		if strings.HasSuffix(m, ".lock") || strings.HasSuffix(m, ".tmp") {
+			continue
+		}
+		backup := strings.TrimSuffix(m, ".gz")
+		files[backup] = append(files[backup], m)
+	}
+	backups := []string{}
+	for backup := range files {
+		backups = append(backups, backup)
+	}
+	sort.Strings(backups)
+
+	for i, backup := range backups {
+		old := false
+		if r.cfg.MaxAge > 0 {
+			info, err := os.Stat(files[backup][0])
+			old = err == nil && time.Since(info.ModTime()) > r.cfg.MaxAge
+		}
+		if !old && (r.cfg.MaxBackups == 0 || i >= len(backups)-r.cfg.MaxBackups) {
+			continue
+		}
+		for _, file := range files[backup] {
+			err := os.Remove(file)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Error removing log backup: %v", err)
+			}
+		}
+	}
+}
+
+// Close syncs the file and waits for any compression to finish.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	close(r.rotated)
+	<-r.stopped
+	if !r.cfg.Fsync.Never {
+		r.f.Sync()
+	}
+	r.lock.Close()
+	return r.f.Close()
+}
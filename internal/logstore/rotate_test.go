@@ -0,0 +1,263 @@
+package logstore
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestLog(t *testing.T, cfg RotateConfig) *RotatingFile {
+	t.Helper()
+	cfg.Path = filepath.Join(t.TempDir(), "game.log")
+	cfg.Fsync = FsyncPolicy{Never: true}
+	r, err := OpenRotating(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// writeLine writes one entry and waits a moment, so backups rotated one
+// after another get different names.
+func writeLine(t *testing.T, r *RotatingFile, message string) {
+	t.Helper()
+	err := r.WriteEntries([]Entry{{Time: time.Now(), Username: "alice", Message: message}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+}
+
+// lineSize is how long the line writeLine writes for a three letter message
+// is, so MaxSize can be set to rotate after a number of lines.
+var lineSize = int64(len(time.Now().Format(time.RFC3339) + " alice: one\n"))
+
+// backups lists the rotated files next to the log, oldest first.
+func backups(t *testing.T, r *RotatingFile) []string {
+	t.Helper()
+	matches, err := filepath.Glob(r.cfg.Path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".lock") {
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in = zr
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotateOnSize(t *testing.T) {
+	r := openTestLog(t, RotateConfig{MaxSize: 2*lineSize + 1})
+	writeLine(t, r, "one")
+	writeLine(t, r, "two")
+	if got := backups(t, r); len(got) != 0 {
+		t.Fatalf("rotated before the file was full: %v", got)
+	}
+	writeLine(t, r, "six")
+	err := r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := backups(t, r)
+	if len(got) != 1 {
+		t.Fatalf("expected one backup, got %v", got)
+	}
+	backup := readLog(t, got[0])
+	if !strings.Contains(backup, "alice: one") || !strings.Contains(backup, "alice: two") {
+		t.Errorf("backup is missing the first lines:\n%s", backup)
+	}
+	if current := readLog(t, r.cfg.Path); !strings.HasSuffix(current, "alice: six\n") || strings.Contains(current, "two") {
+		t.Errorf("expected only the third line in the new file, got:\n%s", current)
+	}
+}
+
+func TestRotateOnTime(t *testing.T) {
+	r := openTestLog(t, RotateConfig{Every: 24 * time.Hour})
+	writeLine(t, r, "day")
+	writeLine(t, r, "now")
+	if got := backups(t, r); len(got) != 0 {
+		t.Fatalf("rotated within the period: %v", got)
+	}
+
+	yesterday := time.Now().Add(-48 * time.Hour)
+	err := os.Chtimes(r.cfg.Path, yesterday, yesterday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLine(t, r, "new")
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := backups(t, r)
+	if len(got) != 1 {
+		t.Fatalf("expected one backup, got %v", got)
+	}
+	if backup := readLog(t, got[0]); !strings.Contains(backup, "now") {
+		t.Errorf("backup is missing the old lines:\n%s", backup)
+	}
+	if current := readLog(t, r.cfg.Path); strings.Contains(current, "now") {
+		t.Errorf("old lines left in the new file:\n%s", current)
+	}
+}
+
+func TestRotateCompress(t *testing.T) {
+	r := openTestLog(t, RotateConfig{MaxSize: lineSize, Compress: true})
+	writeLine(t, r, "one")
+	writeLine(t, r, "two")
+	err := r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := backups(t, r)
+	if len(got) != 1 || !strings.HasSuffix(got[0], ".gz") {
+		t.Fatalf("expected only a compressed backup, got %v", got)
+	}
+	if backup := readLog(t, got[0]); !strings.HasSuffix(backup, "alice: one\n") {
+		t.Errorf("unexpected compressed backup:\n%s", backup)
+	}
+}
+
+func TestRotateRetention(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RotateConfig
+		// old is a backup left by an earlier run, a month old.
+		old  bool
+		want []string
+	}{
+		{
+			name: "keep all",
+			cfg:  RotateConfig{MaxSize: lineSize},
+			want: []string{"1", "2", "3", "4"},
+		},
+		{
+			name: "max backups",
+			cfg:  RotateConfig{MaxSize: lineSize, MaxBackups: 2},
+			want: []string{"3", "4"},
+		},
+		{
+			name: "max backups compressed",
+			cfg:  RotateConfig{MaxSize: lineSize, MaxBackups: 2, Compress: true},
+			want: []string{"3", "4"},
+		},
+		{
+			name: "max age",
+			cfg:  RotateConfig{MaxSize: lineSize, MaxAge: 24 * time.Hour},
+			old:  true,
+			want: []string{"1", "2", "3", "4"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := openTestLog(t, tc.cfg)
+			if tc.old {
+				old := r.cfg.Path + ".20000101T000000.000"
+				err := os.WriteFile(old, []byte("ancient\n"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				month := time.Now().Add(-30 * 24 * time.Hour)
+				err = os.Chtimes(old, month, month)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, line := range []string{"1", "2", "3", "4", "5"} {
+				writeLine(t, r, line)
+			}
+			err := r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, backup := range backups(t, r) {
+				if strings.HasSuffix(backup, ".gz") != tc.cfg.Compress {
+					t.Errorf("unexpected backup %s", backup)
+				}
+				got = append(got, strings.TrimSpace(readLog(t, backup)))
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected backups %v, got %v", tc.want, got)
+			}
+			for i, backup := range got {
+				if !strings.HasSuffix(backup, "alice: "+tc.want[i]) {
+					t.Errorf("backup %d is %q, expected line %s", i, backup, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestRotateCompressAndPrune rotates backups big enough to take a while to
+// compress, faster than they can be compressed, and checks pruning never
+// leaves a half-written or uncompressed backup.
+func TestRotateCompressAndPrune(t *testing.T) {
+	noise := make([]byte, 256<<10)
+	_, err := rand.Read(noise)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := hex.EncodeToString(noise)
+	r := openTestLog(t, RotateConfig{MaxSize: int64(len(message)), MaxBackups: 3, Compress: true})
+	for range 20 {
+		err := r.WriteEntries([]Entry{{Time: time.Now(), Username: "alice", Message: message}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := backups(t, r)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 backups, got %v", got)
+	}
+	for _, backup := range got {
+		if !strings.HasSuffix(backup, ".gz") {
+			t.Fatalf("expected only compressed backups, got %v", got)
+		}
+		if !strings.HasSuffix(readLog(t, backup), message+"\n") {
+			t.Errorf("%s is not a whole backup", backup)
+		}
+	}
+}
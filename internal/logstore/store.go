@@ -0,0 +1,155 @@
+// Package logstore keeps the server's game log: player logs, chat and admin
+// actions. Entries are batched and written to an SQLite database that can be
+// queried, and optionally appended to a plain-text file as well.
+package logstore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	_ "modernc.org/sqlite"
+)
+
+// The kinds of entry in the game log.
+const (
+	EventGame  = "game"
+	EventChat  = "chat"
+	EventAudit = "audit"
+)
+
+type Entry struct {
+	Time     time.Time
+	Username string
+	Message  string
+	Event    string
+	GameID   string
+}
+
+func FromGameLog(gl routing.GameLog, event string) Entry {
+	return Entry{
+		Time:     gl.CurrentTime,
+		Username: gl.Username,
+		Message:  gl.Message,
+		Event:    event,
+		GameID:   gl.GameID,
+	}
+}
+
+// Sink is somewhere a batch of entries is written.
+type Sink interface {
+	WriteEntries(entries []Entry) error
+}
+
+// DB is the SQLite game log. Several servers may share one file; SQLite
+// serializes their writes.
+type DB struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS game_logs (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	time     INTEGER NOT NULL,
+	username TEXT NOT NULL,
+	message  TEXT NOT NULL,
+	event    TEXT NOT NULL,
+	game_id  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS game_logs_time ON game_logs (time);
+CREATE INDEX IF NOT EXISTS game_logs_username ON game_logs (username, time);
+`
+
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, fmt.Errorf("could not open log database: %v", err)
+	}
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create log tables: %v", err)
+	}
+	return &DB{db: db}, nil
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// WriteEntries inserts the batch in one transaction.
+func (d *DB) WriteEntries(entries []Entry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO game_logs (time, username, message, event, game_id) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		_, err = stmt.Exec(e.Time.UnixNano(), e.Username, e.Message, e.Event, e.GameID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Tail returns the last n entries, oldest first.
+func (d *DB) Tail(n int) ([]Entry, error) {
+	return d.query("", nil, n)
+}
+
+// Search returns the last n entries whose message contains text.
+func (d *DB) Search(text string, n int) ([]Entry, error) {
+	return d.query("WHERE message LIKE ? ESCAPE '\\'", []any{"%" + escapeLike(text) + "%"}, n)
+}
+
+// By returns the last n entries from a player.
+func (d *DB) By(username string, n int) ([]Entry, error) {
+	return d.query("WHERE username = ?", []any{username}, n)
+}
+
+// Since returns the first n entries logged at or after t.
+func (d *DB) Since(t time.Time, n int) ([]Entry, error) {
+	rows, err := d.db.Query("SELECT time, username, message, event, game_id FROM game_logs WHERE time >= ? ORDER BY time, id LIMIT ?", t.UnixNano(), n)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// query returns the last n entries matching where, oldest first.
+func (d *DB) query(where string, args []any, n int) ([]Entry, error) {
+	q := fmt.Sprintf("SELECT time, username, message, event, game_id FROM (SELECT * FROM game_logs %s ORDER BY time DESC, id DESC LIMIT ?) ORDER BY time, id", where)
+	rows, err := d.db.Query(q, append(args, n)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func scanEntries(rows *sql.Rows) ([]Entry, error) {
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var nanos int64
+		err := rows.Scan(&nanos, &e.Username, &e.Message, &e.Event, &e.GameID)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(0, nanos)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,83 @@
+package logstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func benchEntries(n int) []Entry {
+	entries := make([]Entry, n)
+	now := time.Now()
+	for i := range entries {
+		entries[i] = Entry{
+			Time:     now.Add(time.Duration(i)),
+			Username: fmt.Sprintf("player%d", i%8),
+			Message:  "player1 won a war against player2",
+			Event:    EventGame,
+			GameID:   "a1b2c3",
+		}
+	}
+	return entries
+}
+
+func openBenchDB(b *testing.B) *DB {
+	b.Helper()
+	db, err := Open(filepath.Join(b.TempDir(), "game_logs.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// BenchmarkDBWriteEntries stores batches of each size in SQLite, reporting
+// entries per second so batch sizes can be compared.
+func BenchmarkDBWriteEntries(b *testing.B) {
+	for _, size := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			db := openBenchDB(b)
+			entries := benchEntries(size)
+			b.ResetTimer()
+			for range b.N {
+				err := db.WriteEntries(entries)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*size)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
+
+// BenchmarkWriterWrite is the server's path for player logs: one Write of a
+// batch to the database and the rotating text log.
+func BenchmarkWriterWrite(b *testing.B) {
+	for _, size := range []int{1, 100} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			db := openBenchDB(b)
+			file, err := OpenRotating(RotateConfig{
+				Path:       filepath.Join(b.TempDir(), "game.log"),
+				MaxSize:    10 << 20,
+				MaxBackups: 3,
+				Fsync:      FsyncPolicy{Never: true},
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer file.Close()
+			w := NewWriter(size, time.Second, db, file)
+			defer w.Close()
+			entries := benchEntries(size)
+			b.ResetTimer()
+			for range b.N {
+				err := w.Write(entries)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*size)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
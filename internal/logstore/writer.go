@@ -0,0 +1,106 @@
+package logstore
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Writer collects entries and writes them to every sink in batches, once
+// batchSize entries are waiting or flushEvery has passed.
+type Writer struct {
+	sinks      []Sink
+	batchSize  int
+	flushEvery time.Duration
+	pending    []Entry
+	flush      chan struct{}
+	done       chan struct{}
+	stopped    chan struct{}
+	mu         *sync.Mutex
+	// writing keeps batches from interleaving in the sinks.
+	writing *sync.Mutex
+}
+
+func NewWriter(batchSize int, flushEvery time.Duration, sinks ...Sink) *Writer {
+	w := &Writer{
+		sinks:      sinks,
+		batchSize:  max(batchSize, 1),
+		flushEvery: flushEvery,
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		mu:         &sync.Mutex{},
+		writing:    &sync.Mutex{},
+	}
+	go w.run()
+	return w
+}
+
+// Add queues an entry. It is written by the next flush, so an entry still
+// queued when the server dies is lost.
+func (w *Writer) Add(e Entry) {
+	w.mu.Lock()
+	w.pending = append(w.pending, e)
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Write writes entries to every sink straight away, for callers that must
+// know they are stored. The first sink is the primary: only its error is
+// returned, and the others' are logged.
+func (w *Writer) Write(entries []Entry) error {
+	w.writing.Lock()
+	defer w.writing.Unlock()
+	var primaryErr error
+	for i, sink := range w.sinks {
+		err := sink.WriteEntries(entries)
+		if err != nil && i == 0 {
+			primaryErr = err
+		} else if err != nil {
+			log.Printf("Error writing %d game log(s): %v", len(entries), err)
+		}
+	}
+	return primaryErr
+}
+
+// Close writes whatever is queued and stops the writer.
+func (w *Writer) Close() {
+	close(w.done)
+	<-w.stopped
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.flush:
+		case <-w.done:
+			w.write()
+			return
+		}
+		w.write()
+	}
+}
+
+func (w *Writer) write() {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	err := w.Write(batch)
+	if err != nil {
+		log.Printf("Error writing %d game log(s): %v", len(batch), err)
+	}
+}
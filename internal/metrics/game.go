@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type PlayerUnits struct {
+	GameID string
+	Player string
+	Units  int
+}
+
+var unitsDesc = prometheus.NewDesc("peril_units", "Units each player has, by game.", []string{"game", "player"}, nil)
+
+// unitsCollector reads the unit counts when scraped, so they are never stale.
+type unitsCollector func() []PlayerUnits
+
+func (c unitsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- unitsDesc
+}
+
+func (c unitsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, pu := range c() {
+		ch <- prometheus.MustNewConstMetric(unitsDesc, prometheus.GaugeValue, float64(pu.Units), pu.GameID, pu.Player)
+	}
+}
+
+// RegisterUnits reports peril_units from f. Call it once per process.
+func RegisterUnits(f func() []PlayerUnits) {
+	Registry.MustRegister(unitsCollector(f))
+}
+
+// ObserveWar counts a war the server refereed.
+func ObserveWar(attackerPower, defenderPower int) {
+	switch {
+	case attackerPower > defenderPower:
+		Wars.WithLabelValues("attacker_won").Inc()
+	case defenderPower > attackerPower:
+		Wars.WithLabelValues("defender_won").Inc()
+	default:
+		Wars.WithLabelValues("draw").Inc()
+	}
+}
@@ -0,0 +1,222 @@
+// Package metrics exports Prometheus metrics for the messages flowing through
+// pubsub and for what happens in games.
+package metrics
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// PollInterval is how often PollQueues usually checks queue depths.
+const PollInterval = 15 * time.Second
+
+// Registry holds every Peril metric plus the Go runtime and process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	Published = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_messages_published_total",
+		Help: "Messages published, by exchange and routing key pattern.",
+	}, []string{"exchange", "key"})
+	Consumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_messages_consumed_total",
+		Help: "Messages handled, by exchange, binding key pattern and how they were acked.",
+	}, []string{"exchange", "key", "ack"})
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "peril_handler_duration_seconds",
+		Help:    "How long subscription handlers take, by exchange and binding key pattern.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"exchange", "key"})
+	DecodeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_decode_failures_total",
+		Help: "Messages that could not be decoded, by exchange and binding key pattern.",
+	}, []string{"exchange", "key"})
+	DeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_dead_lettered_total",
+		Help: "Messages rejected to the dead letter exchange, by routing key pattern.",
+	}, []string{"key"})
+	Connects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_amqp_connects_total",
+		Help: "Attempts to connect to the broker, by result; more than one ok is a reconnect.",
+	}, []string{"result"})
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "peril_queue_depth",
+		Help: "Messages ready in each queue this process consumes from.",
+	}, []string{"queue"})
+
+	Spawns = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "peril_game_spawns_total",
+		Help: "Units spawned.",
+	})
+	Moves = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "peril_game_moves_total",
+		Help: "Army moves made (client) or refereed (server).",
+	})
+	Wars = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_game_wars_total",
+		Help: "Wars fought, by outcome: won, lost or draw on a client; attacker_won, defender_won or draw on the server.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Published, Consumed, HandlerDuration, DecodeFailures, DeadLettered, Connects, QueueDepth,
+		Spawns, Moves, Wars,
+	)
+}
+
+// Serve exposes /metrics on addr until the process exits.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Metrics listening on %s", addr)
+	err := srv.ListenAndServe()
+	if err != nil {
+		log.Printf("Error serving metrics: %v", err)
+	}
+}
+
+// Dial connects to the broker, counting the attempt.
+func Dial(url string, config amqp.Config) (*amqp.Connection, error) {
+	conn, err := amqp.DialConfig(url, config)
+	if err != nil {
+		Connects.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	Connects.WithLabelValues("ok").Inc()
+	return conn, nil
+}
+
+// ack labels an ack type, keeping unknown strings out of the label values.
+func ack(acktype string) string {
+	switch acktype {
+	case "Ack", "NackRequeue", "NackDiscard":
+		return acktype
+	}
+	return "unknown"
+}
+
+// ObserveHandler records a handled message and how long its handler took,
+// in seconds.
+func ObserveHandler(exchange, key, acktype string, seconds float64) {
+	label := KeyLabel(key)
+	Consumed.WithLabelValues(exchange, label, ack(acktype)).Inc()
+	HandlerDuration.WithLabelValues(exchange, label).Observe(seconds)
+}
+
+// ObserveBatch records a batch of n messages handled together.
+func ObserveBatch(exchange, key, acktype string, n int, seconds float64) {
+	label := KeyLabel(key)
+	Consumed.WithLabelValues(exchange, label, ack(acktype)).Add(float64(n))
+	HandlerDuration.WithLabelValues(exchange, label).Observe(seconds)
+}
+
+// KeyLabel turns a routing key into a pattern with game IDs, player names and
+// other IDs replaced by *, so labels stay few: game.ab12.army_moves.bob
+// becomes game.*.army_moves.* and admin.bob becomes admin.*.
+func KeyLabel(key string) string {
+	parts := strings.Split(key, ".")
+	out := []string{}
+	for len(parts) > 0 && parts[0] == "inbound" {
+		out = append(out, parts[0])
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return strings.Join(out, ".")
+	}
+	keep := 1
+	if parts[0] == "game" && len(parts) > 2 {
+		// game.<id>.<kind>...
+		out = append(out, "game", "*")
+		parts = parts[2:]
+	}
+	for i, part := range parts {
+		if i < keep || part == "*" || part == "#" {
+			out = append(out, part)
+		} else {
+			out = append(out, "*")
+		}
+	}
+	return strings.Join(out, ".")
+}
+
+// queues are the queues whose depth PollQueues reports.
+var queues = struct {
+	names map[string]bool
+	mu    *sync.Mutex
+}{names: map[string]bool{}, mu: &sync.Mutex{}}
+
+// WatchQueue adds a queue to the ones PollQueues reports.
+func WatchQueue(name string) {
+	queues.mu.Lock()
+	defer queues.mu.Unlock()
+	queues.names[name] = true
+}
+
+// PollQueues sets peril_queue_depth for every watched queue each interval,
+// forgetting queues that no longer exist.
+func PollQueues(conn *amqp.Connection, every time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		queues.mu.Lock()
+		names := []string{}
+		for name := range queues.names {
+			names = append(names, name)
+		}
+		queues.mu.Unlock()
+
+		for _, name := range names {
+			depth, err := queueDepth(conn, name)
+			var amqpErr *amqp.Error
+			if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+				queues.mu.Lock()
+				delete(queues.names, name)
+				queues.mu.Unlock()
+				QueueDepth.DeleteLabelValues(name)
+				continue
+			}
+			if err != nil {
+				log.Printf("Error polling depth of %s: %v", name, err)
+				continue
+			}
+			QueueDepth.WithLabelValues(name).Set(float64(depth))
+		}
+	}
+}
+
+// queueDepth uses a channel of its own, since a failed passive declare closes
+// the channel it was made on.
+func queueDepth(conn *amqp.Connection, name string) (int, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+	q, err := ch.QueueDeclarePassive(name, false, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return q.Messages, nil
+}
@@ -0,0 +1,92 @@
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// BanList is the persisted set of banned players and why they were banned.
+type BanList struct {
+	path   string
+	banned map[string]string
+	mu     *sync.RWMutex
+}
+
+func LoadBanList(path string) (*BanList, error) {
+	b := &BanList{
+		path:   path,
+		banned: map[string]string{},
+		mu:     &sync.RWMutex{},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read ban list: %v", err)
+	}
+	err = json.Unmarshal(data, &b.banned)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ban list: %v", err)
+	}
+	return b, nil
+}
+
+func (b *BanList) Ban(username, reason string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.banned[username] = reason
+	return b.save()
+}
+
+func (b *BanList) Unban(username string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.banned, username)
+	return b.save()
+}
+
+func (b *BanList) IsBanned(username string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.banned[username]
+	return ok
+}
+
+func (b *BanList) List() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	banned := []string{}
+	for username := range b.banned {
+		banned = append(banned, username)
+	}
+	sort.Strings(banned)
+	return banned
+}
+
+// save writes through a temp file so servers sharing the list never read a
+// half-written file.
+func (b *BanList) save() error {
+	data, err := json.MarshalIndent(b.banned, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not write ban list: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write ban list: %v", err)
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
@@ -0,0 +1,170 @@
+package moderation
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a time that only moves when the test says so.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestLimiterBurst(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(1, 3)
+	l.now = clock.Now
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("alice") {
+			t.Fatalf("message %d of the burst was limited", i+1)
+		}
+	}
+	if l.Allow("alice") {
+		t.Error("expected the message after the burst to be limited")
+	}
+	if !l.Allow("bob") {
+		t.Error("expected bob to have a separate bucket")
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(2, 2)
+	l.now = clock.Now
+
+	l.Allow("alice")
+	l.Allow("alice")
+	if l.Allow("alice") {
+		t.Fatal("expected an empty bucket")
+	}
+	clock.Advance(250 * time.Millisecond)
+	if l.Allow("alice") {
+		t.Error("half a token should not be enough")
+	}
+	clock.Advance(250 * time.Millisecond)
+	if !l.Allow("alice") {
+		t.Error("expected a token after half a second at 2 per second")
+	}
+
+	// Refilling stops at the burst.
+	clock.Advance(time.Hour)
+	allowed := 0
+	for l.Allow("alice") {
+		allowed++
+	}
+	if allowed != 2 {
+		t.Errorf("expected a full bucket of 2, got %d", allowed)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := NewLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if !l.Allow("alice") {
+			t.Fatal("a zero rate should not limit")
+		}
+	}
+}
+
+func TestSpamDetectorRepeats(t *testing.T) {
+	clock := newFakeClock()
+	d := NewSpamDetector(time.Minute, 2, nil)
+	d.now = clock.Now
+
+	for i := 0; i < 2; i++ {
+		if reason := d.Check("alice", "attack!"); reason != "" {
+			t.Fatalf("message %d flagged: %s", i+1, reason)
+		}
+	}
+	// Case and spacing don't make a message different.
+	reason := d.Check("alice", "  ATTACK! ")
+	if !strings.Contains(reason, "repeated the same message 3 times") {
+		t.Fatalf("expected the third repeat to be flagged, got %q", reason)
+	}
+	if reason := d.Check("bob", "attack!"); reason != "" {
+		t.Errorf("bob's first message flagged: %s", reason)
+	}
+	if reason := d.Check("alice", "retreat"); reason != "" {
+		t.Errorf("a different message flagged: %s", reason)
+	}
+
+	// Repeats older than the window are forgotten.
+	clock.Advance(time.Minute + time.Second)
+	if reason := d.Check("alice", "attack!"); reason != "" {
+		t.Errorf("flagged after the window passed: %s", reason)
+	}
+}
+
+func TestSpamDetectorKnownQuotes(t *testing.T) {
+	d := NewSpamDetector(time.Minute, 0, []string{"Never interrupt your enemy when he is making a mistake."})
+	if reason := d.Check("alice", "never interrupt your enemy  when he is making a mistake."); reason != "known spam quote" {
+		t.Errorf("expected a known quote, got %q", reason)
+	}
+	for i := 0; i < 10; i++ {
+		if reason := d.Check("alice", "hello"); reason != "" {
+			t.Fatalf("repeats flagged with repeat checks off: %s", reason)
+		}
+	}
+}
+
+func TestMuteList(t *testing.T) {
+	m := NewMuteList()
+	m.Mute("bob")
+	m.Mute("alice")
+	if !m.IsMuted("alice") || !m.IsMuted("bob") {
+		t.Fatal("expected alice and bob to be muted")
+	}
+	if got := strings.Join(m.List(), ","); got != "alice,bob" {
+		t.Errorf("expected alice,bob, got %s", got)
+	}
+	m.Unmute("alice")
+	if m.IsMuted("alice") {
+		t.Error("alice is still muted")
+	}
+	m.Unmute("carol")
+	if got := strings.Join(m.List(), ","); got != "bob" {
+		t.Errorf("expected bob, got %s", got)
+	}
+}
+
+func TestBanList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	b, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Ban("mallory", "spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsBanned("mallory") {
+		t.Fatal("expected the ban to be saved")
+	}
+	err = reloaded.Unban("mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.IsBanned("mallory") {
+		t.Error("mallory is still banned")
+	}
+}
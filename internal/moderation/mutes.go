@@ -0,0 +1,49 @@
+package moderation
+
+import (
+	"sort"
+	"sync"
+)
+
+// MuteList is the set of players whose free text is quarantined.
+type MuteList struct {
+	muted map[string]struct{}
+	mu    *sync.RWMutex
+}
+
+func NewMuteList() *MuteList {
+	return &MuteList{
+		muted: map[string]struct{}{},
+		mu:    &sync.RWMutex{},
+	}
+}
+
+func (m *MuteList) Mute(username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.muted[username] = struct{}{}
+}
+
+func (m *MuteList) Unmute(username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.muted, username)
+}
+
+func (m *MuteList) IsMuted(username string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.muted[username]
+	return ok
+}
+
+func (m *MuteList) List() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	muted := []string{}
+	for username := range m.muted {
+		muted = append(muted, username)
+	}
+	sort.Strings(muted)
+	return muted
+}
@@ -0,0 +1,54 @@
+package moderation
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a per-player token bucket: each player may send burst messages
+// at once, refilled at rate messages per second.
+type Limiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	// now is time.Now, except in tests.
+	now func() time.Time
+	mu  *sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Allow takes a token from the player's bucket, reporting whether there was one.
+func (l *Limiter) Allow(username string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[username]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[username] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,72 @@
+package moderation
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpamDetector flags players who keep repeating the same message, or who
+// post any of a list of known spam lines.
+type SpamDetector struct {
+	window     time.Duration
+	maxRepeats int
+	known      map[string]struct{}
+	recent     map[string][]sentMessage
+	// now is time.Now, except in tests.
+	now func() time.Time
+	mu  *sync.Mutex
+}
+
+type sentMessage struct {
+	text string
+	at   time.Time
+}
+
+func NewSpamDetector(window time.Duration, maxRepeats int, known []string) *SpamDetector {
+	d := &SpamDetector{
+		window:     window,
+		maxRepeats: maxRepeats,
+		known:      map[string]struct{}{},
+		recent:     map[string][]sentMessage{},
+		now:        time.Now,
+		mu:         &sync.Mutex{},
+	}
+	for _, text := range known {
+		d.known[normalize(text)] = struct{}{}
+	}
+	return d
+}
+
+// Check records a message and returns why it is spam, or "" if it is not.
+func (d *SpamDetector) Check(username, text string) string {
+	text = normalize(text)
+	if _, ok := d.known[text]; ok {
+		return "known spam quote"
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	kept := []sentMessage{}
+	repeats := 0
+	for _, m := range d.recent[username] {
+		if now.Sub(m.at) > d.window {
+			continue
+		}
+		kept = append(kept, m)
+		if m.text == text {
+			repeats++
+		}
+	}
+	d.recent[username] = append(kept, sentMessage{text: text, at: now})
+	if d.maxRepeats > 0 && repeats >= d.maxRepeats {
+		return fmt.Sprintf("repeated the same message %d times in %v", repeats+1, d.window)
+	}
+	return ""
+}
+
+func normalize(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
@@ -0,0 +1,171 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
+)
+
+// ErrUnknownCommand is returned by Execute for commands that are not game
+// commands, so each kind of player can add its own.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Execute runs one game command: spawn, move, status, the diplomacy commands
+// or chat.
+func (p *Player) Execute(words []string) error {
+	if len(words) == 0 {
+		return nil
+	}
+	switch words[0] {
+	case "spawn":
+		p.touch()
+		spawn, err := p.gs.CommandSpawn(words)
+		if err != nil {
+			return err
+		}
+		return pubsub.PublishJSON(p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.GameKey(p.gameID, routing.SpawnPrefix, p.username)), spawn, p.session)
+
+	case "move":
+		p.touch()
+		ctx, span := tracing.Start(context.Background(), "CommandMove")
+		defer span.End()
+		move, err := p.gs.CommandMove(words)
+		if err != nil {
+			return err
+		}
+		return pubsub.PublishJSONWithContext(ctx, p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.GameKey(p.gameID, routing.ArmyMovesPrefix, p.username)), move, p.session)
+
+	case "status":
+		p.gs.CommandStatus()
+		return nil
+
+	case "propose-alliance", "propose-pact":
+		relation := gamelogic.RelationAlliance
+		if words[0] == "propose-pact" {
+			relation = gamelogic.RelationPact
+		}
+		dm, err := p.gs.CommandPropose(words, relation)
+		if err != nil {
+			return err
+		}
+		return p.publishDiplomacy(dm)
+
+	case "accept":
+		dm, err := p.gs.CommandAccept(words)
+		if err != nil {
+			return err
+		}
+		return p.publishDiplomacy(dm)
+
+	case "break-alliance":
+		dm, err := p.gs.CommandBreakAlliance(words)
+		if err != nil {
+			return err
+		}
+		return p.publishDiplomacy(dm)
+
+	case "say":
+		msg, err := p.gs.CommandSay(words)
+		if err != nil {
+			return err
+		}
+		return p.publishChat(msg)
+
+	case "whisper":
+		msg, err := p.gs.CommandWhisper(words)
+		if err != nil {
+			return err
+		}
+		return p.publishChat(msg)
+
+	case "ally-chat":
+		msgs, err := p.gs.CommandAllyChat(words)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			err = p.publishChat(msg)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrUnknownCommand
+}
+
+func (p *Player) publishDiplomacy(dm gamelogic.DiplomacyMessage) error {
+	err := pubsub.PublishJSON(p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.GameKey(p.gameID, routing.DiplomacyPrefix, p.username)), dm, p.session)
+	if err != nil {
+		return fmt.Errorf("could not publish diplomacy message: %v", err)
+	}
+	return nil
+}
+
+func (p *Player) publishChat(msg routing.ChatMessage) error {
+	err := pubsub.PublishJSON(p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.ChatKey(p.gameID, msg.Kind, msg.From, msg.To)), msg, p.session)
+	if err != nil {
+		return fmt.Errorf("could not publish chat message: %v", err)
+	}
+	return nil
+}
+
+// PublishGameLog adds a message from this player to the game's log.
+func (p *Player) PublishGameLog(message string) error {
+	return p.publishGameLog(context.Background(), message)
+}
+
+func (p *Player) publishGameLog(ctx context.Context, message string) error {
+	return pubsub.PublishGobWithContext(ctx, p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.GameKey(p.gameID, routing.GameLogSlug, p.username)), routing.GameLog{
+		CurrentTime: time.Now(),
+		Message:     message,
+		Username:    p.username,
+		GameID:      p.gameID,
+	}, p.session)
+}
+
+// touch marks the player as active now, for the idle time others see.
+func (p *Player) touch() {
+	p.lastActive.Store(time.Now().UnixNano())
+}
+
+func (p *Player) PublishPresence(kind routing.PresenceKind) {
+	var lastActive time.Time
+	if nanos := p.lastActive.Load(); nanos != 0 {
+		lastActive = time.Unix(0, nanos)
+	}
+	err := pubsub.PublishJSON(p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.GameKey(p.gameID, routing.PresencePrefix, p.username)), routing.Presence{
+		Kind:       kind,
+		Username:   p.username,
+		GameID:     p.gameID,
+		Units:      len(p.gs.GetPlayerSnap().Units),
+		LastActive: lastActive,
+		Time:       time.Now(),
+	}, p.session)
+	if err != nil {
+		log.Printf("%s: error publishing presence: %v", p.username, err)
+	}
+}
+
+// Heartbeat sends a join, then a heartbeat every interval until done is
+// closed.
+func (p *Player) Heartbeat(interval time.Duration, done <-chan struct{}) {
+	p.PublishPresence(routing.PresenceJoin)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.PublishPresence(routing.PresenceHeartbeat)
+		}
+	}
+}
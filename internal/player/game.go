@@ -0,0 +1,195 @@
+package player
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
+)
+
+// Handlers are what a kind of player does with a message beyond updating its
+// game state, which has already happened when they are called. Any of them
+// may be nil.
+type Handlers struct {
+	Pause    func(ps routing.PlayingState)
+	Move     func(move gamelogic.ArmyMove, outcome gamelogic.MoveOutcome)
+	War      func(rw gamelogic.RecognitionOfWar, outcome gamelogic.WarOutcome, winner, loser string)
+	GameOver func(gameOver routing.GameOver)
+	// Admin is called when the player is kicked or banned. The player should
+	// stop playing.
+	Admin     func(m routing.Moderation)
+	Wipe      func(w routing.Wipe)
+	Diplomacy func(dm gamelogic.DiplomacyMessage)
+	// Chat is only called for messages the player was shown.
+	Chat func(msg routing.ChatMessage)
+	// Presence also subscribes to other players' presence when set.
+	Presence func(p routing.Presence)
+}
+
+// Subscribe declares the player's queues in the game it joined and handles
+// what arrives on them. Only the server's signature is accepted on what the
+// server sends, so the player must have logged in.
+func (p *Player) Subscribe(h Handlers) error {
+	if p.server == nil {
+		return errNotLoggedIn
+	}
+	gameID, username := p.gameID, p.username
+	err := pubsub.SubscribeJSON(p.conn, routing.ExchangePerilDirect, routing.GameKey(gameID, routing.PauseKey, username), routing.GameKey(gameID, routing.PauseKey), 1, func(ps routing.PlayingState) string {
+		p.gs.HandlePause(ps)
+		if h.Pause != nil {
+			h.Pause(ps)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(p.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.ArmyMovesPrefix, username), routing.GameKey(gameID, routing.ArmyMovesPrefix, "*"), 1, func(ctx context.Context, move gamelogic.ArmyMove) string {
+		return p.handleMove(ctx, move, h.Move, h.War)
+	}, pubsub.WithVerifier(p.keys), pubsub.WithRelay(p.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(p.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.WarRecognitionsPrefix), routing.GameKey(gameID, routing.WarRecognitionsPrefix, "*"), 0, func(ctx context.Context, rw gamelogic.RecognitionOfWar) string {
+		return p.handleWar(ctx, rw, h.War)
+	}, pubsub.WithVerifier(p.keys), pubsub.WithRelay(p.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(p.conn, routing.ExchangePerilDirect, routing.GameKey(gameID, routing.GameOverKey, username), routing.GameKey(gameID, routing.GameOverKey), 1, func(gameOver routing.GameOver) string {
+		p.gs.HandleGameOver(gameOver)
+		if h.GameOver != nil {
+			h.GameOver(gameOver)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(p.conn, routing.ExchangePerilDirect, fmt.Sprintf("%s.%s", routing.AdminPrefix, username), fmt.Sprintf("%s.%s", routing.AdminPrefix, username), 1, func(m routing.Moderation) string {
+		p.gs.HandleAdmin(m)
+		if h.Admin != nil {
+			h.Admin(m)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(p.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.WipePrefix, username), routing.GameKey(gameID, routing.WipePrefix, "*"), 1, func(w routing.Wipe) string {
+		p.gs.HandleWipe(w)
+		if h.Wipe != nil {
+			h.Wipe(w)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.server))
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSON(p.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.DiplomacyPrefix, username), routing.GameKey(gameID, routing.DiplomacyPrefix, "*"), 1, func(dm gamelogic.DiplomacyMessage) string {
+		p.gs.HandleDiplomacy(dm)
+		if h.Diplomacy != nil {
+			h.Diplomacy(dm)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.keys), pubsub.WithRelay(p.server))
+	if err != nil {
+		return err
+	}
+	err = p.subscribeChat(h.Chat)
+	if err != nil {
+		return err
+	}
+	if h.Presence == nil {
+		return nil
+	}
+	return pubsub.SubscribeJSON(p.conn, routing.ExchangePerilTopic, routing.GameKey(gameID, routing.PresencePrefix, username), routing.GameKey(gameID, routing.PresencePrefix, "*"), 1, func(presence routing.Presence) string {
+		h.Presence(presence)
+		return "Ack"
+	}, pubsub.WithVerifier(p.keys), pubsub.WithRelay(p.server))
+}
+
+// subscribeChat receives everything said in the game, and the whispers and
+// ally chat sent to this player.
+func (p *Player) subscribeChat(handle func(routing.ChatMessage)) error {
+	queue := routing.GameKey(p.gameID, routing.ChatPrefix, p.username)
+	err := pubsub.SubscribeJSON(p.conn, routing.ExchangePerilTopic, queue, routing.ChatKey(p.gameID, routing.ChatSay, "*", ""), 1, func(msg routing.ChatMessage) string {
+		if p.gs.HandleChat(msg) && handle != nil {
+			handle(msg)
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.keys), pubsub.WithRelay(p.server))
+	if err != nil {
+		return err
+	}
+	for _, kind := range []routing.ChatKind{routing.ChatWhisper, routing.ChatAlly} {
+		err = pubsub.Bind(p.conn, routing.ExchangePerilTopic, queue, routing.ChatKey(p.gameID, kind, "*", p.username))
+		if err != nil {
+			return fmt.Errorf("could not subscribe to chat: %v", err)
+		}
+	}
+	return nil
+}
+
+// handleMove publishes a recognition of war when the move reaches the
+// player's units, then resolves the defender's side of it.
+func (p *Player) handleMove(ctx context.Context, move gamelogic.ArmyMove, handle func(gamelogic.ArmyMove, gamelogic.MoveOutcome), handleWar func(gamelogic.RecognitionOfWar, gamelogic.WarOutcome, string, string)) string {
+	ctx, span := tracing.Start(ctx, "HandleMove")
+	defer span.End()
+	outcome := p.gs.HandleMove(move)
+	if handle != nil {
+		handle(move, outcome)
+	}
+	switch outcome {
+	case gamelogic.MoveOutcomeSamePlayer:
+		return "NackDiscard"
+	case gamelogic.MoveOutComeSafe:
+		return "Ack"
+	case gamelogic.MoveOutcomeMakeWar:
+		rw := p.gs.RecognizeWar(move)
+		err := pubsub.PublishJSONWithContext(ctx, p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.GameKey(p.gameID, routing.WarRecognitionsPrefix, p.username)), rw, p.session)
+		if err != nil {
+			return "NackRequeue"
+		}
+		// The attacker logs the war when it resolves its side.
+		outcome, winner, loser := p.gs.DefendWar(rw)
+		if handleWar != nil {
+			handleWar(rw, outcome, winner, loser)
+		}
+		return "Ack"
+	default:
+		return "NackDiscard"
+	}
+}
+
+// handleWar resolves the wars this player is in and logs the outcome. Wars
+// between other players go back on the shared queue for them.
+func (p *Player) handleWar(ctx context.Context, rw gamelogic.RecognitionOfWar, handle func(gamelogic.RecognitionOfWar, gamelogic.WarOutcome, string, string)) string {
+	ctx, span := tracing.Start(ctx, "HandleWar")
+	defer span.End()
+	outcome, winner, loser := p.gs.HandleWar(rw)
+	if handle != nil {
+		handle(rw, outcome, winner, loser)
+	}
+	message := ""
+	switch outcome {
+	case gamelogic.WarOutcomeNotInvolved:
+		return "NackRequeue"
+	case gamelogic.WarOutcomeNoUnits, gamelogic.WarOutcomeAllied:
+		return "NackDiscard"
+	case gamelogic.WarOutcomeYouWon, gamelogic.WarOutcomeOpponentWon:
+		message = fmt.Sprintf("%s won a war against %s", winner, loser)
+	case gamelogic.WarOutcomeDraw:
+		message = fmt.Sprintf("A war between %s and %s resulted in a draw", winner, loser)
+	default:
+		return "NackDiscard"
+	}
+	err := p.publishGameLog(ctx, message)
+	if err != nil {
+		return "NackRequeue"
+	}
+	return "Ack"
+}
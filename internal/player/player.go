@@ -0,0 +1,243 @@
+// Package player is one player's side of a game: logging in, the lobby, the
+// queues a player consumes and the messages it publishes. The client, bots and
+// the gateway all play through it, so the server and other players can't tell
+// them apart.
+package player
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const replyTimeout = 10 * time.Second
+
+var errNotLoggedIn = errors.New("log in first, to learn the server's key")
+
+type Player struct {
+	username string
+	// signer is who the player signs as: the username, or the gateway's
+	// signer for it.
+	signer string
+	gameID string
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	gs     *gamelogic.GameState
+	keys   *pubsub.KeyRegistry
+	// server holds only the server's key, for what the server announces.
+	server     *pubsub.KeyRegistry
+	session    pubsub.PublishOption
+	lobby      chan routing.LobbyResponse
+	lastActive atomic.Int64
+}
+
+// New opens a channel for the player and declares the queue for the signing
+// keys other players register, so none announced while logging in are missed.
+// Login starts reading it once it has the server's key.
+func New(conn *amqp.Connection, username string) (*Player, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	p := &Player{
+		username: username,
+		signer:   username,
+		conn:     conn,
+		ch:       ch,
+		gs:       gamelogic.NewGameState(username),
+		keys:     pubsub.NewKeyRegistry(),
+		session:  pubsub.Combine(),
+		lobby:    make(chan routing.LobbyResponse, 1),
+	}
+	keysCh, _, err := pubsub.DeclareAndBind(conn, routing.ExchangePerilTopic, p.keysQueue(), fmt.Sprintf("%s.*", routing.KeysPrefix), 1)
+	if err != nil {
+		return nil, err
+	}
+	keysCh.Close()
+	return p, nil
+}
+
+func (p *Player) keysQueue() string {
+	return fmt.Sprintf("%s.%s", routing.KeysPrefix, p.username)
+}
+
+// followKeys trusts serverKey for the server's announcements and adds the
+// keys it announces.
+func (p *Player) followKeys(serverKey ed25519.PublicKey) error {
+	if p.server != nil {
+		return nil
+	}
+	p.server = pubsub.NewKeyRegistry()
+	p.server.Add(routing.ServerSigner, serverKey)
+	return pubsub.SubscribeJSON(p.conn, routing.ExchangePerilTopic, p.keysQueue(), fmt.Sprintf("%s.*", routing.KeysPrefix), 1, func(pk routing.PlayerKey) string {
+		p.keys.Add(pk.Username, pk.PublicKey)
+		return "Ack"
+	}, pubsub.WithVerifier(p.server))
+}
+
+func (p *Player) Username() string {
+	return p.username
+}
+
+// GameID is the game the player joined, or is watching.
+func (p *Player) GameID() string {
+	return p.gameID
+}
+
+func (p *Player) GameState() *gamelogic.GameState {
+	return p.gs
+}
+
+// Keys are the public keys of every player, for verifying their messages.
+func (p *Player) Keys() *pubsub.KeyRegistry {
+	return p.keys
+}
+
+// ServerKeys holds only the server's key, for verifying what the server
+// sends. It is nil until the player logs in.
+func (p *Player) ServerKeys() *pubsub.KeyRegistry {
+	return p.server
+}
+
+// UseGatewayKey makes Login pin its key as the gateway's for the player, next
+// to the key the player's own client pinned, and sign with it. The gateway
+// holds that key, so the player's own never leaves their machine.
+func (p *Player) UseGatewayKey() {
+	p.signer = routing.GatewaySigner(p.username)
+}
+
+// Login authenticates with a password, or a session token from an earlier
+// login, registering new players with their password. The player signs what
+// it publishes with key from then on. A nil key only checks the password or
+// token, so the key need not be loaded until the player is known.
+func (p *Player) Login(password, token string, key ed25519.PrivateKey) (routing.LoginResponse, error) {
+	// The request goes straight to the server's queue and the answer straight
+	// back to this channel, so no other player can see the password or token.
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return routing.LoginResponse{}, fmt.Errorf("could not log in: %v", err)
+	}
+	defer ch.Close()
+	replies, err := ch.Consume(pubsub.DirectReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return routing.LoginResponse{}, fmt.Errorf("could not log in: %v", err)
+	}
+
+	req := routing.LoginRequest{
+		Username: p.username,
+		Password: password,
+		Token:    token,
+		Gateway:  p.signer != p.username,
+	}
+	if key != nil {
+		req.PublicKey = key.Public().(ed25519.PublicKey)
+	}
+	err = pubsub.PublishJSON(ch, pubsub.DefaultExchange, routing.LoginKey, req, pubsub.WithReplyTo(pubsub.DirectReplyTo))
+	if err != nil {
+		return routing.LoginResponse{}, fmt.Errorf("could not log in: %v", err)
+	}
+
+	select {
+	case delivery, ok := <-replies:
+		if !ok {
+			return routing.LoginResponse{}, errors.New("the server closed the login channel")
+		}
+		var resp routing.LoginResponse
+		err = json.Unmarshal(delivery.Body, &resp)
+		if err != nil {
+			return routing.LoginResponse{}, fmt.Errorf("could not read the login response: %v", err)
+		}
+		if resp.Error != "" {
+			return resp, errors.New(resp.Error)
+		}
+		for username, publicKey := range resp.PublicKeys {
+			p.keys.Add(username, publicKey)
+		}
+		err = p.followKeys(resp.ServerKey)
+		if err != nil {
+			return resp, fmt.Errorf("could not follow signing keys: %v", err)
+		}
+		if key != nil {
+			p.session = pubsub.Combine(
+				pubsub.WithHeader(routing.SessionHeader, resp.Token),
+				pubsub.WithSignature(p.signer, key),
+			)
+		}
+		return resp, nil
+	case <-time.After(replyTimeout):
+		return routing.LoginResponse{}, errors.New("the server did not answer, is it running?")
+	}
+}
+
+// SubscribeLobby starts listening for the lobby's answers to LobbyRequest,
+// once the player has logged in.
+func (p *Player) SubscribeLobby() error {
+	if p.server == nil {
+		return errNotLoggedIn
+	}
+	replyKey := fmt.Sprintf("%s.%s", routing.LobbyKey, p.username)
+	err := pubsub.SubscribeJSON(p.conn, routing.ExchangePerilDirect, replyKey, replyKey, 1, func(resp routing.LobbyResponse) string {
+		// A late answer to a request that timed out is dropped.
+		select {
+		case p.lobby <- resp:
+		default:
+		}
+		return "Ack"
+	}, pubsub.WithVerifier(p.server))
+	if err != nil {
+		return fmt.Errorf("could not reach the lobby: %v", err)
+	}
+	return nil
+}
+
+// LobbyRequest sends req to the server's lobby and waits for the answer. An
+// answer with a game ID means the player joined, or is watching, that game.
+func (p *Player) LobbyRequest(req routing.LobbyRequest) (routing.LobbyResponse, error) {
+	req.Username = p.username
+	err := pubsub.PublishJSON(p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.LobbyKey), req, p.session)
+	if err != nil {
+		return routing.LobbyResponse{}, fmt.Errorf("could not reach the lobby: %v", err)
+	}
+	select {
+	case resp := <-p.lobby:
+		if resp.Error != "" {
+			return resp, errors.New(resp.Error)
+		}
+		if resp.GameID != "" {
+			p.gameID = resp.GameID
+		}
+		return resp, nil
+	case <-time.After(replyTimeout):
+		return routing.LobbyResponse{}, errors.New("the lobby did not answer, is the server running?")
+	}
+}
+
+// Join joins gameID, or creates a game called create and joins that.
+func (p *Player) Join(gameID, create string) error {
+	req := routing.LobbyRequest{Action: routing.LobbyJoin, GameID: gameID}
+	if create != "" {
+		req = routing.LobbyRequest{Action: routing.LobbyCreate, Name: create}
+	}
+	_, err := p.LobbyRequest(req)
+	return err
+}
+
+func (p *Player) Leave() {
+	err := pubsub.PublishJSON(p.ch, routing.ExchangePerilTopic, routing.InboundKey(routing.LobbyKey), routing.LobbyRequest{
+		Action:   routing.LobbyLeave,
+		Username: p.username,
+		GameID:   p.gameID,
+	}, p.session)
+	if err != nil {
+		log.Printf("%s: error leaving game: %v", p.username, err)
+	}
+}
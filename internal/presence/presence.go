@@ -0,0 +1,106 @@
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type Entry struct {
+	Username   string
+	GameID     string
+	Units      int
+	JoinedAt   time.Time
+	LastSeen   time.Time
+	LastActive time.Time
+}
+
+// Table tracks who is online from their join, heartbeat and leave messages.
+// Players not heard from within the timeout are expired.
+type Table struct {
+	timeout time.Duration
+	entries map[string]Entry
+	mu      *sync.Mutex
+}
+
+func NewTable(timeout time.Duration) *Table {
+	return &Table{
+		timeout: timeout,
+		entries: map[string]Entry{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+func entryKey(gameID, username string) string {
+	return gameID + "/" + username
+}
+
+func (t *Table) Update(p routing.Presence) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := entryKey(p.GameID, p.Username)
+	if p.Kind == routing.PresenceLeave {
+		delete(t.entries, key)
+		return
+	}
+	e, ok := t.entries[key]
+	if !ok {
+		e = Entry{
+			Username: p.Username,
+			GameID:   p.GameID,
+			JoinedAt: time.Now(),
+		}
+	}
+	e.Units = p.Units
+	e.LastSeen = time.Now()
+	e.LastActive = p.LastActive
+	t.entries[key] = e
+}
+
+// Expire removes and returns the players that have gone silent.
+func (t *Table) Expire() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expired := []Entry{}
+	for key, e := range t.entries {
+		if time.Since(e.LastSeen) > t.timeout {
+			expired = append(expired, e)
+			delete(t.entries, key)
+		}
+	}
+	return expired
+}
+
+// Run expires silent players every interval until done is closed.
+func (t *Table) Run(interval time.Duration, done <-chan struct{}, onExpire func(Entry)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for _, e := range t.Expire() {
+				onExpire(e)
+			}
+		}
+	}
+}
+
+func (t *Table) List() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := []Entry{}
+	for _, e := range t.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].GameID != entries[j].GameID {
+			return entries[i].GameID < entries[j].GameID
+		}
+		return entries[i].Username < entries[j].Username
+	})
+	return entries
+}
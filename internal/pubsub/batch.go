@@ -0,0 +1,152 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SubscribeGobBatch hands the handler up to batchSize messages at a time,
+// or fewer once maxWait has passed since the first, and settles the whole
+// batch with one multiple ack or nack.
+func SubscribeGobBatch[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType int, // an enum to represent "durable" or "transient"
+	batchSize int,
+	maxWait time.Duration,
+	handler func([]T) string,
+	opts ...SubscribeOption,
+) error {
+	return SubscribeGobBatchWithContext(conn, exchange, queueName, key, simpleQueueType, batchSize, maxWait, func(_ []context.Context, batch []T) string {
+		return handler(batch)
+	}, opts...)
+}
+
+// SubscribeGobBatchWithContext also hands the handler each message's context,
+// in the same order as the batch. Every message keeps its own trace, with its
+// consumer span open until the batch is settled.
+func SubscribeGobBatchWithContext[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType int, // an enum to represent "durable" or "transient"
+	batchSize int,
+	maxWait time.Duration,
+	handler func([]context.Context, []T) string,
+	opts ...SubscribeOption,
+) error {
+	options := newSubscribeOptions(opts)
+	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
+	if err != nil {
+		return err
+	}
+
+	// The broker has to be willing to send a full batch before any is acked.
+	batchSize = max(batchSize, 1)
+	err = channel.Qos(batchSize, 0, false)
+	if err != nil {
+		log.Printf("Error setting channel QoS: %v", err)
+	}
+	deliveryChan, err := channel.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		log.Printf("Error getting delivery channel: %v", err)
+		return err
+	}
+	go func(D <-chan amqp.Delivery) {
+		batch := []T{}
+		ctxs := []context.Context{}
+		spans := []trace.Span{}
+		var last amqp.Delivery
+		timer := time.NewTimer(maxWait)
+		stopTimer(timer)
+
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			start := time.Now()
+			acktype := handler(ctxs, batch)
+			metrics.ObserveBatch(exchange, key, acktype, len(batch), time.Since(start).Seconds())
+			for _, span := range spans {
+				span.SetAttributes(semconv.MessagingBatchMessageCount(len(batch)))
+				endConsume(span, acktype)
+			}
+			switch acktype {
+			case "Ack":
+				last.Ack(true)
+			case "NackRequeue":
+				log.Printf("NackRequeue for %d message(s) up to key: %v\n", len(batch), last.RoutingKey)
+				last.Nack(true, true)
+			default:
+				log.Printf("NackDiscard for %d message(s) up to key: %v\n", len(batch), last.RoutingKey)
+				last.Nack(true, false)
+			}
+			batch = batch[:0]
+			ctxs = ctxs[:0]
+			spans = spans[:0]
+		}
+
+		for {
+			select {
+			case delivery, ok := <-D:
+				if !ok {
+					flush()
+					return
+				}
+				ctx, span := startConsume(exchange, delivery)
+				var data T
+				err := gob.NewDecoder(bytes.NewBuffer(delivery.Body)).Decode(&data)
+				if err != nil {
+					log.Printf("Error decoding gob: %v", err)
+					metrics.DecodeFailures.WithLabelValues(exchange, metrics.KeyLabel(key)).Inc()
+					deadLetter(channel, delivery, "could not decode message")
+					rejectConsume(span, "could not decode message")
+					continue
+				}
+				if reason := options.verify(delivery, data); reason != "" {
+					deadLetter(channel, delivery, reason)
+					rejectConsume(span, reason)
+					continue
+				}
+				if len(batch) == 0 {
+					timer.Reset(maxWait)
+				}
+				batch = append(batch, data)
+				ctxs = append(ctxs, ctx)
+				spans = append(spans, span)
+				last = delivery
+				if len(batch) >= batchSize {
+					stopTimer(timer)
+					flush()
+				}
+			case <-timer.C:
+				flush()
+			}
+		}
+	}(deliveryChan)
+
+	return nil
+}
+
+// stopTimer stops t and drains a tick it already sent, so the next Reset
+// can't flush the following batch early. Timers drain themselves from Go
+// 1.23, but go.mod still asks for 1.22 behaviour.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -6,26 +6,82 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"log"
+	"time"
 
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
+const (
+	// DefaultExchange delivers each message to the queue its key names, and
+	// nowhere else.
+	DefaultExchange = ""
+	// DirectReplyTo is the broker's pseudo-queue for replies straight to the
+	// channel that asked, see WithReplyTo.
+	DirectReplyTo = "amq.rabbitmq.reply-to"
+)
+
+// Names and limits for the queues DeclareAndBind and the subscriptions set
+// up. Commands change them from their config before subscribing.
+var (
+	DeadLetterExchange = "peril_dlx"
+	DeadLetterQueue    = "peril_dlq"
+	// Prefetch is how many unacked gob messages a subscription may hold.
+	Prefetch = 10
+)
+
+// PublishOption adjusts an outgoing message after its body has been encoded.
+// It is given the routing key the message is published under.
+type PublishOption func(key string, msg *amqp.Publishing)
+
+func WithHeader(key string, value interface{}) PublishOption {
+	return func(_ string, msg *amqp.Publishing) {
+		if msg.Headers == nil {
+			msg.Headers = amqp.Table{}
+		}
+		msg.Headers[key] = value
+	}
+}
+
+// WithReplyTo asks whoever handles the message to publish its answer to the
+// default exchange under queue.
+func WithReplyTo(queue string) PublishOption {
+	return func(_ string, msg *amqp.Publishing) {
+		msg.ReplyTo = queue
+	}
+}
+
+// Combine applies several options in order.
+func Combine(opts ...PublishOption) PublishOption {
+	return func(key string, msg *amqp.Publishing) {
+		for _, opt := range opts {
+			opt(key, msg)
+		}
+	}
+}
+
+func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
+	return PublishJSONWithContext(context.Background(), ch, exchange, key, val, opts...)
+}
+
+// PublishJSONWithContext publishes as a child of the span in ctx, so the
+// trace carries on in whoever handles the message.
+func PublishJSONWithContext[T any](ctx context.Context, ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
 	jsonData, err := json.Marshal(val)
 	if err != nil {
 		log.Printf("Error marshalling JSON: %s", err)
 		return err
 	}
 
-	err = ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{
+	msg := amqp.Publishing{
 		ContentType:  "application/json",
 		Body:         jsonData,
 		DeliveryMode: 2,
-	})
-	if err != nil {
-		return err
 	}
-	return nil
+	for _, opt := range opts {
+		opt(key, &msg)
+	}
+	return Publish(ctx, ch, exchange, key, msg)
 }
 
 func DeclareAndBind(
@@ -54,12 +110,12 @@ func DeclareAndBind(
 	}
 
 	deadLetter := amqp.Table{
-		"x-dead-letter-exchange": "peril_dlx",
+		"x-dead-letter-exchange": DeadLetterExchange,
 	}
 
 	var queue amqp.Queue
 
-	if queueName == "peril_dlq" {
+	if queueName == DeadLetterQueue {
 		queue, err = chanName.QueueDeclare(queueName, durable, autoDelete, exclusive, false, nil)
 		if err != nil {
 			log.Printf("Error declaring pubsub queue: %v", err)
@@ -73,15 +129,35 @@ func DeclareAndBind(
 		}
 	}
 
-	err = chanName.QueueBind(queueName, key, exchange, false, nil)
-	if err != nil {
-		log.Printf("Error binding pubsub queue: %v", err)
-		return nil, amqp.Queue{}, err
+	// The default exchange delivers to the queue named by the key, and can't
+	// be bound.
+	if exchange != DefaultExchange {
+		err = chanName.QueueBind(queueName, key, exchange, false, nil)
+		if err != nil {
+			log.Printf("Error binding pubsub queue: %v", err)
+			return nil, amqp.Queue{}, err
+		}
 	}
+	metrics.WatchQueue(queueName)
 
 	return chanName, queue, nil
 }
 
+// Bind adds another binding to an existing queue.
+func Bind(conn *amqp.Connection, exchange, queueName, key string) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	err = ch.QueueBind(queueName, key, exchange, false, nil)
+	if err != nil {
+		log.Printf("Error binding pubsub queue: %v", err)
+		return err
+	}
+	return nil
+}
+
 func SubscribeJSON[T any](
 	conn *amqp.Connection,
 	exchange,
@@ -89,7 +165,25 @@ func SubscribeJSON[T any](
 	key string,
 	simpleQueueType int, // an enum to represent "durable" or "transient"
 	handler func(T) string,
+	opts ...SubscribeOption,
 ) error {
+	return SubscribeJSONWithContext(conn, exchange, queueName, key, simpleQueueType, func(_ context.Context, data T) string {
+		return handler(data)
+	}, opts...)
+}
+
+// SubscribeJSONWithContext hands the handler a context holding the span that
+// continues the publisher's trace, for handlers that publish in turn.
+func SubscribeJSONWithContext[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType int, // an enum to represent "durable" or "transient"
+	handler func(context.Context, T) string,
+	opts ...SubscribeOption,
+) error {
+	options := newSubscribeOptions(opts)
 	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
 	if err != nil {
 		return err
@@ -102,9 +196,25 @@ func SubscribeJSON[T any](
 	}
 	go func(D <-chan amqp.Delivery) {
 		for delivery := range D {
+			ctx, span := startConsume(exchange, delivery)
 			var data T
-			json.Unmarshal(delivery.Body, &data)
-			acktype := handler(data)
+			err := json.Unmarshal(delivery.Body, &data)
+			if err != nil {
+				log.Printf("Error decoding JSON: %v", err)
+				metrics.DecodeFailures.WithLabelValues(exchange, metrics.KeyLabel(key)).Inc()
+				deadLetter(channel, delivery, "could not decode message")
+				rejectConsume(span, "could not decode message")
+				continue
+			}
+			if reason := options.verify(delivery, data); reason != "" {
+				deadLetter(channel, delivery, reason)
+				rejectConsume(span, reason)
+				continue
+			}
+			start := time.Now()
+			acktype := handler(ctx, data)
+			metrics.ObserveHandler(exchange, key, acktype, time.Since(start).Seconds())
+			endConsume(span, acktype)
 			switch {
 			case acktype == "Ack":
 				log.Printf("Ack for key: %v Message Body: %v\n", delivery.RoutingKey, data)
@@ -125,7 +235,12 @@ func SubscribeJSON[T any](
 	return nil
 }
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
+func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
+	return PublishGobWithContext(context.Background(), ch, exchange, key, val, opts...)
+}
+
+// PublishGobWithContext is PublishGob as a child of the span in ctx.
+func PublishGobWithContext[T any](ctx context.Context, ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) error {
 	var buffer bytes.Buffer
 	encoder := gob.NewEncoder(&buffer)
 	err := encoder.Encode(val)
@@ -133,15 +248,15 @@ func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
 		return err
 	}
 
-	err = ch.Publish(exchange, key, false, false, amqp.Publishing{
+	msg := amqp.Publishing{
 		ContentType:  "application/gob",
 		Body:         buffer.Bytes(),
 		DeliveryMode: 2,
-	})
-	if err != nil {
-		return err
 	}
-	return nil
+	for _, opt := range opts {
+		opt(key, &msg)
+	}
+	return Publish(ctx, ch, exchange, key, msg)
 }
 
 func SubscribeGob[T any](
@@ -151,13 +266,30 @@ func SubscribeGob[T any](
 	key string,
 	simpleQueueType int, // an enum to represent "durable" or "transient"
 	handler func(T) string,
+	opts ...SubscribeOption,
+) error {
+	return SubscribeGobWithContext(conn, exchange, queueName, key, simpleQueueType, func(_ context.Context, data T) string {
+		return handler(data)
+	}, opts...)
+}
+
+// SubscribeGobWithContext is SubscribeGob with the consumer span's context.
+func SubscribeGobWithContext[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType int, // an enum to represent "durable" or "transient"
+	handler func(context.Context, T) string,
+	opts ...SubscribeOption,
 ) error {
+	options := newSubscribeOptions(opts)
 	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
 	if err != nil {
 		return err
 	}
 
-	err = channel.Qos(10, 0, true)
+	err = channel.Qos(Prefetch, 0, true)
 	if err != nil {
 		log.Printf("Error setting channel QoS: %v", err)
 	}
@@ -168,16 +300,27 @@ func SubscribeGob[T any](
 	}
 	go func(D <-chan amqp.Delivery) {
 		for delivery := range D {
+			ctx, span := startConsume(exchange, delivery)
 			var data T
 			buffer := bytes.NewBuffer(delivery.Body)
 			decoder := gob.NewDecoder(buffer)
-			err = decoder.Decode(&data)
+			err := decoder.Decode(&data)
 			if err != nil {
-				log.Println(data)
 				log.Printf("Error decoding gob: %v", err)
-				return
+				metrics.DecodeFailures.WithLabelValues(exchange, metrics.KeyLabel(key)).Inc()
+				deadLetter(channel, delivery, "could not decode message")
+				rejectConsume(span, "could not decode message")
+				continue
 			}
-			acktype := handler(data)
+			if reason := options.verify(delivery, data); reason != "" {
+				deadLetter(channel, delivery, reason)
+				rejectConsume(span, reason)
+				continue
+			}
+			start := time.Now()
+			acktype := handler(ctx, data)
+			metrics.ObserveHandler(exchange, key, acktype, time.Since(start).Seconds())
+			endConsume(span, acktype)
 			switch {
 			case acktype == "Ack":
 				log.Printf("Ack for key: %v Message Body: %v\n", delivery.RoutingKey, data)
@@ -197,3 +340,73 @@ func SubscribeGob[T any](
 
 	return nil
 }
+
+// SubscribeDelivery hands the handler the raw delivery, for consumers that
+// need headers or forward bodies without decoding them.
+func SubscribeDelivery(
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType int, // an enum to represent "durable" or "transient"
+	handler func(amqp.Delivery) string,
+	opts ...SubscribeOption,
+) error {
+	return SubscribeDeliveryWithContext(conn, exchange, queueName, key, simpleQueueType, func(_ context.Context, delivery amqp.Delivery) string {
+		return handler(delivery)
+	}, opts...)
+}
+
+// SubscribeDeliveryWithContext is SubscribeDelivery with the consumer span's
+// context.
+func SubscribeDeliveryWithContext(
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType int, // an enum to represent "durable" or "transient"
+	handler func(context.Context, amqp.Delivery) string,
+	opts ...SubscribeOption,
+) error {
+	options := newSubscribeOptions(opts)
+	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
+	if err != nil {
+		return err
+	}
+
+	deliveryChan, err := channel.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		log.Printf("Error getting delivery channel: %v", err)
+		return err
+	}
+	go func(D <-chan amqp.Delivery) {
+		for delivery := range D {
+			ctx, span := startConsume(exchange, delivery)
+			if reason := options.verify(delivery, nil); reason != "" {
+				deadLetter(channel, delivery, reason)
+				rejectConsume(span, reason)
+				continue
+			}
+			start := time.Now()
+			acktype := handler(ctx, delivery)
+			metrics.ObserveHandler(exchange, key, acktype, time.Since(start).Seconds())
+			endConsume(span, acktype)
+			switch {
+			case acktype == "Ack":
+				log.Printf("Ack for key: %v\n", delivery.RoutingKey)
+				delivery.Ack(false)
+			case acktype == "NackRequeue":
+				log.Printf("NackRequeue for key: %v\n", delivery.RoutingKey)
+				delivery.Nack(false, true)
+			case acktype == "NackDiscard":
+				log.Printf("NackDiscard for key: %v\n", delivery.RoutingKey)
+				delivery.Nack(false, false)
+			default:
+				log.Printf("Default for key: %v\n", delivery.RoutingKey)
+				delivery.Nack(false, false)
+			}
+		}
+	}(deliveryChan)
+
+	return nil
+}
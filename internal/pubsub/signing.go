@@ -0,0 +1,192 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	SignerHeader       = "x-peril-signer"
+	SignatureHeader    = "x-peril-signature"
+	RejectReasonHeader = "x-peril-reject-reason"
+	// RelaySignatureHeader is the server's countersignature on a message it
+	// relayed.
+	RelaySignatureHeader = "x-peril-relay-signature"
+)
+
+// Sender is implemented by messages that name the player who sent them, so a
+// verified subscription can check the claim against the signer.
+type Sender interface {
+	Sender() string
+}
+
+// WithSignature signs the routing key and encoded body with the player's
+// Ed25519 key, so a signed message can't be replayed under another key.
+func WithSignature(signer string, key ed25519.PrivateKey) PublishOption {
+	return func(routingKey string, msg *amqp.Publishing) {
+		WithHeader(SignerHeader, signer)(routingKey, msg)
+		WithHeader(SignatureHeader, ed25519.Sign(key, signedPayload(routingKey, msg.Body)))(routingKey, msg)
+	}
+}
+
+// WithRelaySignature countersigns a relayed message with the server's key, so
+// players can tell it passed the relay's checks.
+func WithRelaySignature(key ed25519.PrivateKey) PublishOption {
+	return func(routingKey string, msg *amqp.Publishing) {
+		WithHeader(RelaySignatureHeader, ed25519.Sign(key, signedPayload(routingKey, msg.Body)))(routingKey, msg)
+	}
+}
+
+// signedPayload is what a signature covers. Messages sent through the relay
+// are signed under the key it republishes them to, which is the key without
+// routing.InboundPrefix, so the relay and the players verify the same bytes.
+func signedPayload(routingKey string, body []byte) []byte {
+	routingKey = strings.TrimPrefix(routingKey, routing.InboundPrefix+".")
+	return append([]byte(routingKey+"\n"), body...)
+}
+
+// KeyRegistry holds the public keys of known players.
+type KeyRegistry struct {
+	keys map[string]ed25519.PublicKey
+	mu   *sync.RWMutex
+}
+
+func NewKeyRegistry() *KeyRegistry {
+	return &KeyRegistry{
+		keys: map[string]ed25519.PublicKey{},
+		mu:   &sync.RWMutex{},
+	}
+}
+
+func (r *KeyRegistry) Add(username string, key ed25519.PublicKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[username] = key
+}
+
+func (r *KeyRegistry) Get(username string) (ed25519.PublicKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[username]
+	return key, ok
+}
+
+// Verify checks a delivery's signature and returns who signed it.
+func (r *KeyRegistry) Verify(delivery amqp.Delivery) (string, error) {
+	signer, _ := delivery.Headers[SignerHeader].(string)
+	signature, _ := delivery.Headers[SignatureHeader].([]byte)
+	if signer == "" || len(signature) == 0 {
+		return "", errors.New("message is not signed")
+	}
+	key, ok := r.Get(signer)
+	if !ok {
+		return "", fmt.Errorf("no public key known for signer %s", signer)
+	}
+	if !ed25519.Verify(key, signedPayload(delivery.RoutingKey, delivery.Body), signature) {
+		return "", fmt.Errorf("signature from %s does not match the message", signer)
+	}
+	return signer, nil
+}
+
+// verifyRelayed checks the server's countersignature on a relayed delivery.
+func (r *KeyRegistry) verifyRelayed(delivery amqp.Delivery) error {
+	signature, _ := delivery.Headers[RelaySignatureHeader].([]byte)
+	if len(signature) == 0 {
+		return errors.New("message was not relayed by the server")
+	}
+	key, ok := r.Get(routing.ServerSigner)
+	if !ok {
+		return errors.New("no public key known for the server")
+	}
+	if !ed25519.Verify(key, signedPayload(delivery.RoutingKey, delivery.Body), signature) {
+		return errors.New("relay signature does not match the message")
+	}
+	return nil
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	verifier *KeyRegistry
+	relay    *KeyRegistry
+}
+
+// WithVerifier dead-letters deliveries that are unsigned, signed by an
+// unknown player, tampered with, or that claim to be from someone else.
+func WithVerifier(registry *KeyRegistry) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.verifier = registry
+	}
+}
+
+// WithRelay dead-letters deliveries the relay did not countersign, so nothing
+// published straight to a game key, around the relay's checks, is handled.
+// server holds the key of routing.ServerSigner.
+func WithRelay(server *KeyRegistry) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.relay = server
+	}
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	o := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// verify returns why a delivery should be rejected, or "" if it is fine.
+func (o subscribeOptions) verify(delivery amqp.Delivery, data interface{}) string {
+	if o.relay != nil {
+		err := o.relay.verifyRelayed(delivery)
+		if err != nil {
+			return err.Error()
+		}
+	}
+	if o.verifier == nil {
+		return ""
+	}
+	signer, err := o.verifier.Verify(delivery)
+	if err != nil {
+		return err.Error()
+	}
+	if s, ok := data.(Sender); ok && s.Sender() != routing.SignerPlayer(signer) {
+		return fmt.Sprintf("message claims to be from %s but was signed by %s", s.Sender(), signer)
+	}
+	return ""
+}
+
+// deadLetter republishes a rejected delivery to the dead letter exchange with
+// the reason in a header, then acks the original.
+func deadLetter(ch *amqp.Channel, delivery amqp.Delivery, reason string) {
+	log.Printf("Dead-lettering message for key %v: %s\n", delivery.RoutingKey, reason)
+	metrics.DeadLettered.WithLabelValues(metrics.KeyLabel(delivery.RoutingKey)).Inc()
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	headers[RejectReasonHeader] = reason
+	headers["x-original-routing-key"] = delivery.RoutingKey
+	err := ch.PublishWithContext(context.Background(), DeadLetterExchange, delivery.RoutingKey, false, false, amqp.Publishing{
+		ContentType:  delivery.ContentType,
+		Headers:      headers,
+		Body:         delivery.Body,
+		DeliveryMode: 2,
+	})
+	if err != nil {
+		log.Printf("Error dead-lettering message: %v", err)
+		delivery.Nack(false, false)
+		return
+	}
+	delivery.Ack(false)
+}
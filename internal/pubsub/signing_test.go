@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type testMessage struct {
+	From string
+}
+
+func (m testMessage) Sender() string {
+	return m.From
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// delivery is what a subscriber receives for a message published under key
+// with opts applied, and then routed under routingKey.
+func delivery(key, routingKey, body string, opts ...PublishOption) amqp.Delivery {
+	msg := amqp.Publishing{Body: []byte(body)}
+	for _, opt := range opts {
+		opt(key, &msg)
+	}
+	return amqp.Delivery{RoutingKey: routingKey, Headers: msg.Headers, Body: msg.Body}
+}
+
+func TestVerify(t *testing.T) {
+	alice, gateway, mallory, server := newKey(t), newKey(t), newKey(t), newKey(t)
+	players := NewKeyRegistry()
+	players.Add("alice", alice.Public().(ed25519.PublicKey))
+	players.Add(routing.GatewaySigner("alice"), gateway.Public().(ed25519.PublicKey))
+	servers := NewKeyRegistry()
+	servers.Add(routing.ServerSigner, server.Public().(ed25519.PublicKey))
+
+	const key = "game.a1.army_moves.alice"
+	const body = `{"From":"alice"}`
+	signed := WithSignature("alice", alice)
+	relayed := Combine(signed, WithRelaySignature(server))
+
+	tests := []struct {
+		name     string
+		delivery amqp.Delivery
+		opts     []SubscribeOption
+		// wantReason is part of the dead-letter reason, or "" to accept.
+		wantReason string
+	}{
+		{
+			name:     "signed",
+			delivery: delivery(key, key, body, signed),
+			opts:     []SubscribeOption{WithVerifier(players)},
+		},
+		{
+			name:     "signed through the relay",
+			delivery: delivery(routing.InboundKey(key), key, body, signed),
+			opts:     []SubscribeOption{WithVerifier(players)},
+		},
+		{
+			name:       "unsigned",
+			delivery:   delivery(key, key, body),
+			opts:       []SubscribeOption{WithVerifier(players)},
+			wantReason: "message is not signed",
+		},
+		{
+			name:       "tampered payload",
+			delivery:   tamper(delivery(key, key, body, signed), `{"From":"alice","Units":[]}`),
+			opts:       []SubscribeOption{WithVerifier(players)},
+			wantReason: "signature from alice does not match the message",
+		},
+		{
+			name:       "signed for another routing key",
+			delivery:   delivery("game.b2.army_moves.alice", key, body, signed),
+			opts:       []SubscribeOption{WithVerifier(players)},
+			wantReason: "signature from alice does not match the message",
+		},
+		{
+			name:       "unknown signer",
+			delivery:   delivery(key, key, `{"From":"mallory"}`, WithSignature("mallory", mallory)),
+			opts:       []SubscribeOption{WithVerifier(players)},
+			wantReason: "no public key known for signer mallory",
+		},
+		{
+			name:       "signed as someone else",
+			delivery:   delivery(key, key, `{"From":"bob"}`, signed),
+			opts:       []SubscribeOption{WithVerifier(players)},
+			wantReason: "claims to be from bob but was signed by alice",
+		},
+		{
+			name:     "signed by the gateway for the player",
+			delivery: delivery(key, key, body, WithSignature(routing.GatewaySigner("alice"), gateway)),
+			opts:     []SubscribeOption{WithVerifier(players)},
+		},
+		{
+			name:       "gateway key signing for someone else",
+			delivery:   delivery(key, key, `{"From":"bob"}`, WithSignature(routing.GatewaySigner("alice"), gateway)),
+			opts:       []SubscribeOption{WithVerifier(players)},
+			wantReason: "claims to be from bob but was signed by alice@gateway",
+		},
+		{
+			name:     "countersigned by the relay",
+			delivery: delivery(key, key, body, relayed),
+			opts:     []SubscribeOption{WithVerifier(players), WithRelay(servers)},
+		},
+		{
+			name:       "not relayed",
+			delivery:   delivery(key, key, body, signed),
+			opts:       []SubscribeOption{WithVerifier(players), WithRelay(servers)},
+			wantReason: "message was not relayed by the server",
+		},
+		{
+			name:       "countersigned by someone else",
+			delivery:   delivery(key, key, body, signed, WithRelaySignature(mallory)),
+			opts:       []SubscribeOption{WithVerifier(players), WithRelay(servers)},
+			wantReason: "relay signature does not match the message",
+		},
+		{
+			name:       "countersigned for another routing key",
+			delivery:   delivery("game.b2.army_moves.alice", key, body, relayed),
+			opts:       []SubscribeOption{WithRelay(servers)},
+			wantReason: "relay signature does not match the message",
+		},
+		{
+			name:       "player signing as the server",
+			delivery:   delivery(key, key, body, WithSignature(routing.ServerSigner, alice)),
+			opts:       []SubscribeOption{WithVerifier(servers)},
+			wantReason: "signature from @server does not match the message",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var data testMessage
+			err := json.Unmarshal(tc.delivery.Body, &data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reason := newSubscribeOptions(tc.opts).verify(tc.delivery, data)
+			if tc.wantReason == "" && reason != "" {
+				t.Fatalf("expected the message to be accepted, got %q", reason)
+			}
+			if !strings.Contains(reason, tc.wantReason) {
+				t.Fatalf("expected a reason containing %q, got %q", tc.wantReason, reason)
+			}
+		})
+	}
+}
+
+func tamper(d amqp.Delivery, body string) amqp.Delivery {
+	d.Body = []byte(body)
+	return d
+}
@@ -0,0 +1,66 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Publish sends an already encoded message in a producer span, putting the
+// span's trace context in the message headers for the consumer to continue.
+func Publish(ctx context.Context, ch *amqp.Channel, exchange, key string, msg amqp.Publishing) error {
+	ctx, span := tracing.Start(ctx, "publish "+metrics.KeyLabel(key),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(exchange, key)...),
+	)
+	defer span.End()
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	tracing.Inject(ctx, msg.Headers)
+
+	err := ch.PublishWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	metrics.Published.WithLabelValues(exchange, metrics.KeyLabel(key)).Inc()
+	return nil
+}
+
+// startConsume begins a consumer span continuing the trace in the delivery's
+// headers, or a new trace if it has none.
+func startConsume(exchange string, delivery amqp.Delivery) (context.Context, trace.Span) {
+	ctx := tracing.Extract(context.Background(), delivery.Headers)
+	return tracing.Start(ctx, "process "+metrics.KeyLabel(delivery.RoutingKey),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(exchange, delivery.RoutingKey)...),
+	)
+}
+
+// endConsume records how the handler settled the delivery.
+func endConsume(span trace.Span, acktype string) {
+	span.SetAttributes(attribute.String("peril.ack", acktype))
+	span.End()
+}
+
+// rejectConsume ends the span of a delivery that never reached the handler.
+func rejectConsume(span trace.Span, reason string) {
+	span.SetStatus(codes.Error, reason)
+	span.End()
+}
+
+func messagingAttributes(exchange, key string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingDestinationName(exchange),
+		semconv.MessagingRabbitmqDestinationRoutingKey(key),
+	}
+}
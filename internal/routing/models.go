@@ -2,12 +2,177 @@ package routing
 
 import "time"
 
+type PauseScope string
+
+const (
+	PauseGlobal PauseScope = ""
+	PausePlayer PauseScope = "player"
+	PauseRegion PauseScope = "region"
+)
+
+// PlayingState pauses or resumes the whole game, one player or one region.
+// A non-zero Duration resumes automatically once it has passed.
 type PlayingState struct {
 	IsPaused bool
+	Scope    PauseScope
+	Target   string
+	Duration time.Duration
+	Reason   string
 }
 
 type GameLog struct {
 	CurrentTime time.Time
 	Message     string
 	Username    string
+	GameID      string
+}
+
+func (gl GameLog) Sender() string {
+	return gl.Username
+}
+
+type Standing struct {
+	Username string
+	Units    int
+	Regions  int
+	Score    int
+}
+
+type GameOver struct {
+	GameID    string
+	Winner    string
+	Reason    string
+	EndTime   time.Time
+	Standings []Standing
+}
+
+type LobbyAction string
+
+const (
+	LobbyList   LobbyAction = "list"
+	LobbyCreate LobbyAction = "create"
+	LobbyJoin   LobbyAction = "join"
+	LobbyLeave  LobbyAction = "leave"
+	LobbyWatch  LobbyAction = "watch"
+)
+
+type LobbyRequest struct {
+	Action   LobbyAction
+	Username string
+	GameID   string
+	Name     string
+}
+
+func (req LobbyRequest) Sender() string {
+	return req.Username
+}
+
+type GameInfo struct {
+	ID        string
+	Name      string
+	Players   []string
+	Paused    bool
+	Over      bool
+	CreatedAt time.Time
+}
+
+type LobbyResponse struct {
+	Action LobbyAction
+	GameID string
+	Games  []GameInfo
+	Error  string
+}
+
+type LoginRequest struct {
+	Username string
+	Password string
+	Token    string
+	// PublicKey is pinned for the player's signatures. A login without one
+	// only checks the password or token.
+	PublicKey []byte
+	// Gateway pins PublicKey as the gateway's key for the player, see
+	// GatewaySigner, leaving the player's own key in place.
+	Gateway bool
+}
+
+type LoginResponse struct {
+	Username   string
+	Token      string
+	Registered bool
+	Error      string
+	PublicKeys map[string][]byte
+	// ServerKey verifies what the server signs as ServerSigner.
+	ServerKey []byte
+}
+
+type PlayerKey struct {
+	Username  string
+	PublicKey []byte
+}
+
+type ModerationAction string
+
+const (
+	ModerationMute   ModerationAction = "mute"
+	ModerationUnmute ModerationAction = "unmute"
+	ModerationKick   ModerationAction = "kick"
+	ModerationBan    ModerationAction = "ban"
+	ModerationUnban  ModerationAction = "unban"
+)
+
+// Moderation is broadcast to every server so they all enforce admin actions.
+type Moderation struct {
+	Action ModerationAction
+	Target string
+	Reason string
+	Time   time.Time
+}
+
+// Wipe is the server's authoritative removal of a player's units, from one
+// region or, if Region is empty, everywhere.
+type Wipe struct {
+	Target string
+	Region string
+	Reason string
+}
+
+type PresenceKind string
+
+const (
+	PresenceJoin      PresenceKind = "join"
+	PresenceHeartbeat PresenceKind = "heartbeat"
+	PresenceLeave     PresenceKind = "leave"
+)
+
+type Presence struct {
+	Kind       PresenceKind
+	Username   string
+	GameID     string
+	Units      int
+	LastActive time.Time
+	Time       time.Time
+}
+
+func (p Presence) Sender() string {
+	return p.Username
+}
+
+type ChatKind string
+
+const (
+	ChatSay     ChatKind = "say"
+	ChatWhisper ChatKind = "whisper"
+	ChatAlly    ChatKind = "ally"
+)
+
+type ChatMessage struct {
+	Kind ChatKind
+	From string
+	To   string
+	Text string
+	Time time.Time
+}
+
+func (c ChatMessage) Sender() string {
+	return c.From
 }
@@ -1,16 +1,97 @@
 package routing
 
+import "strings"
+
 const (
 	ArmyMovesPrefix = "army_moves"
 
+	SpawnPrefix = "spawn"
+
 	WarRecognitionsPrefix = "war"
 
 	PauseKey = "pause"
 
 	GameLogSlug = "game_logs"
+
+	DiplomacyPrefix = "diplomacy"
+
+	GameOverKey = "game_over"
+
+	GamePrefix = "game"
+
+	LobbyKey = "lobby"
+
+	// LoginKey is the server's login queue. Logins are published to it on the
+	// default exchange, so no other queue can be bound to see passwords.
+	LoginKey = "auth.login"
+
+	InboundPrefix = "inbound"
+
+	KeysPrefix = "keys"
+
+	ModerationPrefix = "moderation"
+
+	QuarantineKey = "quarantine"
+
+	AdminPrefix = "admin"
+
+	WipePrefix = "wipe"
+
+	PresencePrefix = "presence"
+
+	ChatPrefix     = "chat"
+	SpectatePrefix = "spectate"
 )
 
 const (
+	// SessionHeader carries the client's session token to the server.
+	SessionHeader = "x-peril-session"
+	// SenderHeader is set by the server to the authenticated publisher.
+	SenderHeader = "x-peril-sender"
+	// QuarantineReasonHeader explains why the server quarantined a message.
+	QuarantineReasonHeader = "x-peril-quarantine-reason"
+	// ServerSigner signs what the server announces. It is not a valid
+	// username, so no player can sign as the server.
+	ServerSigner = "@server"
+	// GatewaySuffix marks the key the web gateway signs with for a player,
+	// which is pinned next to the player's own rather than replacing it.
+	GatewaySuffix = "@gateway"
+)
+
+// The exchanges are variables so a config can rename them.
+var (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
 )
+
+// GameKey namespaces a routing key or queue name by game, e.g.
+// GameKey("a1b2", ArmyMovesPrefix, "bob") is "game.a1b2.army_moves.bob".
+func GameKey(gameID string, parts ...string) string {
+	return strings.Join(append([]string{GamePrefix, gameID}, parts...), ".")
+}
+
+// InboundKey is the key clients publish under; the server checks the sender
+// and republishes the message under key.
+func InboundKey(key string) string {
+	return InboundPrefix + "." + key
+}
+
+// ChatKey is the key for a chat message: game.<id>.chat.say.<from> for
+// everyone, or game.<id>.chat.<kind>.<to>.<from> for a single recipient.
+func ChatKey(gameID string, kind ChatKind, from, to string) string {
+	if to == "" {
+		return GameKey(gameID, ChatPrefix, string(kind), from)
+	}
+	return GameKey(gameID, ChatPrefix, string(kind), to, from)
+}
+
+// GatewaySigner is who the gateway signs as for username.
+func GatewaySigner(username string) string {
+	return username + GatewaySuffix
+}
+
+// SignerPlayer is the player a signer signs for: the signer itself, or the
+// player the gateway signs for.
+func SignerPlayer(signer string) string {
+	return strings.TrimSuffix(signer, GatewaySuffix)
+}
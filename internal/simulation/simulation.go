@@ -0,0 +1,331 @@
+// Package simulation plays whole games of Peril in one process, on an
+// in-memory bus that delivers messages the way the RabbitMQ topology does,
+// and checks invariants after every step. Runs are deterministic for a seed.
+//
+// The package tests run seeded and scripted games, and FuzzSimulation feeds
+// arbitrary bytes to Fuzz:
+//
+//	go test -fuzz FuzzSimulation ./internal/simulation
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// PauseSteps is how long the pauses in a randomized run last.
+const PauseSteps = 5
+
+type Config struct {
+	Players int
+	// Steps is how many commands a randomized run issues.
+	Steps int
+	Seed  int64
+	// PauseEvery pauses the game for PauseSteps steps every this many steps
+	// (0 never pauses).
+	PauseEvery int
+	// StrictWars also requires the defender's state to reflect a war.
+	StrictWars bool
+	// Verbose prints the game logic's events instead of discarding them.
+	Verbose bool
+}
+
+// Command is one step of a scripted run: the words a player types, or
+// "pause" and "resume", which the server broadcasts to everyone.
+type Command struct {
+	Player int
+	Words  []string
+}
+
+type Report struct {
+	Steps    int
+	Spawns   int
+	Moves    int
+	Wars     int
+	Rejected int
+	// Violations are the broken invariants, in the order they were found.
+	Violations []string
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%d steps: %d spawns, %d moves, %d wars, %d rejected commands, %d violations",
+		r.Steps, r.Spawns, r.Moves, r.Wars, r.Rejected, len(r.Violations))
+}
+
+// Err returns the violations as an error, or nil if there were none.
+func (r Report) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(r.Violations, "\n"))
+}
+
+// Run plays cfg.Steps randomly chosen commands, handing out the built-in bot
+// strategies to the players in turn.
+func Run(cfg Config) (Report, error) {
+	sim, err := newSim(cfg)
+	if err != nil {
+		return Report{}, err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	names := gamelogic.StrategyNames()
+	strategies := []gamelogic.Strategy{}
+	for i := range sim.players {
+		strategy, err := gamelogic.NewStrategy(names[i%len(names)], rand.New(rand.NewSource(cfg.Seed+int64(i)+1)))
+		if err != nil {
+			return Report{}, err
+		}
+		strategies = append(strategies, strategy)
+	}
+	sim.observe = func(i int, p gamelogic.Player) {
+		strategies[i].Observe(p)
+	}
+
+	for step := 1; step <= cfg.Steps; step++ {
+		if cfg.PauseEvery > 0 && step%cfg.PauseEvery == 0 {
+			sim.step(Command{Words: []string{"pause"}})
+			continue
+		}
+		if cfg.PauseEvery > 0 && step%cfg.PauseEvery == PauseSteps%cfg.PauseEvery && step > PauseSteps {
+			sim.step(Command{Words: []string{"resume"}})
+			continue
+		}
+		player := rng.Intn(len(sim.players))
+		words := strategies[player].Next(sim.players[player])
+		if words == nil {
+			continue
+		}
+		sim.step(Command{Player: player, Words: words})
+	}
+	return sim.report, sim.report.Err()
+}
+
+// RunScript plays the given commands in order.
+func RunScript(cfg Config, commands []Command) (Report, error) {
+	sim, err := newSim(cfg)
+	if err != nil {
+		return Report{}, err
+	}
+
+	for _, cmd := range commands {
+		if cmd.Player < 0 || cmd.Player >= len(sim.players) || len(cmd.Words) == 0 {
+			return sim.report, fmt.Errorf("invalid command %v", cmd)
+		}
+		sim.step(cmd)
+	}
+	return sim.report, sim.report.Err()
+}
+
+// Fuzz turns arbitrary bytes into a three player script, three bytes per
+// command, and runs it with strict war checks off.
+func Fuzz(data []byte) (Report, error) {
+	locations := gamelogic.Locations()
+	ranks := gamelogic.Ranks()
+	commands := []Command{}
+	for i := 0; i+2 < len(data); i += 3 {
+		player, op, arg := int(data[i])%3, data[i+1]%4, int(data[i+2])
+		loc := locations[arg%len(locations)]
+		switch op {
+		case 0:
+			commands = append(commands, Command{Player: player, Words: []string{"spawn", loc, ranks[(arg/len(locations))%len(ranks)]}})
+		case 1:
+			unitID := (arg/len(locations))%8 + 1
+			commands = append(commands, Command{Player: player, Words: []string{"move", loc, fmt.Sprint(unitID)}})
+		case 2:
+			commands = append(commands, Command{Words: []string{"pause"}})
+		case 3:
+			commands = append(commands, Command{Words: []string{"resume"}})
+		}
+	}
+	return RunScript(Config{Players: 3, StrictWars: true}, commands)
+}
+
+// message is something on the bus, delivered in the order it was published.
+type message struct {
+	move  *gamelogic.ArmyMove
+	war   *gamelogic.RecognitionOfWar
+	pause *routing.PlayingState
+}
+
+type sim struct {
+	cfg     Config
+	players []*gamelogic.GameState
+	paused  bool
+	bus     []message
+	observe func(player int, p gamelogic.Player)
+	// unitIDs are the IDs each player's spawns have been given.
+	unitIDs map[string]map[int]bool
+	report  Report
+}
+
+func newSim(cfg Config) (*sim, error) {
+	if cfg.Players < 2 {
+		return nil, errors.New("a simulation needs at least two players")
+	}
+	s := &sim{
+		cfg:     cfg,
+		observe: func(int, gamelogic.Player) {},
+		unitIDs: map[string]map[int]bool{},
+	}
+	for i := range cfg.Players {
+		gs := gamelogic.NewGameState(fmt.Sprintf("player%d", i+1))
+		if !cfg.Verbose {
+			gs.SetPresenter(gamelogic.SilentPresenter{})
+		}
+		s.players = append(s.players, gs)
+	}
+	return s, nil
+}
+
+func (s *sim) violation(format string, args ...interface{}) {
+	s.report.Violations = append(s.report.Violations, fmt.Sprintf("step %d: %s", s.report.Steps, fmt.Sprintf(format, args...)))
+}
+
+// step runs one command, then delivers everything it caused.
+func (s *sim) step(cmd Command) {
+	s.report.Steps++
+	switch cmd.Words[0] {
+	case "pause", "resume":
+		s.paused = cmd.Words[0] == "pause"
+		s.bus = append(s.bus, message{pause: &routing.PlayingState{IsPaused: s.paused}})
+	case "spawn":
+		s.spawn(cmd)
+	case "move":
+		s.move(cmd)
+	default:
+		s.violation("unknown command %v", cmd.Words)
+	}
+	s.deliver()
+	s.checkUnits()
+}
+
+func (s *sim) spawn(cmd Command) {
+	gs := s.players[cmd.Player]
+	before := len(gs.GetPlayerSnap().Units)
+	spawn, err := gs.CommandSpawn(cmd.Words)
+	if err != nil {
+		s.report.Rejected++
+		return
+	}
+	s.report.Spawns++
+	name := gs.GetUsername()
+	if s.unitIDs[name] == nil {
+		s.unitIDs[name] = map[int]bool{}
+	}
+	if s.unitIDs[name][spawn.Unit.ID] {
+		s.violation("%s was given unit ID %d again", name, spawn.Unit.ID)
+	}
+	s.unitIDs[name][spawn.Unit.ID] = true
+	if s.paused {
+		s.violation("%s spawned %v while the game was paused", gs.GetUsername(), cmd.Words)
+	}
+	if after := len(gs.GetPlayerSnap().Units); after != before+1 {
+		s.violation("%s spawned %v but went from %d to %d units", gs.GetUsername(), cmd.Words, before, after)
+	}
+}
+
+func (s *sim) move(cmd Command) {
+	gs := s.players[cmd.Player]
+	move, err := gs.CommandMove(cmd.Words)
+	if err != nil {
+		s.report.Rejected++
+		return
+	}
+	s.report.Moves++
+	if s.paused {
+		s.violation("%s moved %v while the game was paused", gs.GetUsername(), cmd.Words)
+	}
+	s.bus = append(s.bus, message{move: &move})
+}
+
+// deliver empties the bus. Moves and pauses go to every player; a war goes to
+// the players in turn until one handles it, like the shared war queue.
+func (s *sim) deliver() {
+	for len(s.bus) > 0 {
+		msg := s.bus[0]
+		s.bus = s.bus[1:]
+		switch {
+		case msg.pause != nil:
+			for _, gs := range s.players {
+				gs.HandlePause(*msg.pause)
+			}
+		case msg.move != nil:
+			for i, gs := range s.players {
+				outcome := gs.HandleMove(*msg.move)
+				if outcome == gamelogic.MoveOutcomeSamePlayer {
+					continue
+				}
+				s.observe(i, msg.move.Player)
+				if outcome == gamelogic.MoveOutcomeMakeWar {
+					rw := gs.RecognizeWar(*msg.move)
+					s.bus = append(s.bus, message{war: &rw})
+					gs.DefendWar(rw)
+				}
+			}
+		case msg.war != nil:
+			s.war(*msg.war)
+		}
+	}
+}
+
+func (s *sim) war(rw gamelogic.RecognitionOfWar) {
+	for _, gs := range s.players {
+		outcome, winner, loser := gs.HandleWar(rw)
+		if outcome == gamelogic.WarOutcomeNotInvolved {
+			continue
+		}
+		if outcome != gamelogic.WarOutcomeNoUnits {
+			s.report.Wars++
+			s.checkWar(rw, outcome, winner, loser)
+		}
+		return
+	}
+	s.violation("nobody handled the war between %s and %s", rw.Attacker.Username, rw.Defender.Username)
+}
+
+// checkWar recomputes the war from the defender's side and checks both
+// players agree with the resolver.
+func (s *sim) checkWar(rw gamelogic.RecognitionOfWar, outcome gamelogic.WarOutcome, winner, loser string) {
+	loc := gamelogic.OverlappingLocation(rw.Attacker, rw.Defender)
+	attackerPower, defenderPower := rw.Attacker.PowerIn(loc), rw.Defender.PowerIn(loc)
+
+	wantWinner, wantLoser := rw.Attacker.Username, rw.Defender.Username
+	if defenderPower > attackerPower {
+		wantWinner, wantLoser = wantLoser, wantWinner
+	}
+	draw := attackerPower == defenderPower
+	if draw != (outcome == gamelogic.WarOutcomeDraw) || winner != wantWinner || loser != wantLoser {
+		s.violation("war in %s (%d vs %d): resolver says %s beat %s (outcome %d)", loc, attackerPower, defenderPower, winner, loser, outcome)
+	}
+
+	for _, gs := range s.players {
+		name := gs.GetUsername()
+		if name != rw.Attacker.Username && (name != rw.Defender.Username || !s.cfg.StrictWars) {
+			continue
+		}
+		lost := draw || name == wantLoser
+		if lost && gs.GetPlayerSnap().PowerIn(loc) > 0 {
+			s.violation("%s lost the war in %s but still has units there", name, loc)
+		}
+	}
+}
+
+// checkUnits checks every unit is filed under its own ID in a real region.
+func (s *sim) checkUnits() {
+	for _, gs := range s.players {
+		for id, unit := range gs.GetPlayerSnap().Units {
+			if unit.ID != id {
+				s.violation("%s has unit %d filed under ID %d", gs.GetUsername(), unit.ID, id)
+			}
+			if !gamelogic.IsValidLocation(string(unit.Location)) {
+				s.violation("%s has unit %d in unknown region %s", gs.GetUsername(), id, unit.Location)
+			}
+		}
+	}
+}
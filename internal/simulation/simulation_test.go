@@ -0,0 +1,126 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+)
+
+func words(s string) []string {
+	return strings.Fields(s)
+}
+
+func TestRun(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3, 42} {
+		report, err := Run(Config{Players: 4, Steps: 500, Seed: seed, PauseEvery: 40, StrictWars: true})
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if report.Spawns == 0 || report.Moves == 0 {
+			t.Errorf("seed %d: expected spawns and moves, got %v", seed, report)
+		}
+	}
+}
+
+func TestRunDeterministic(t *testing.T) {
+	cfg := Config{Players: 3, Steps: 300, Seed: 7, PauseEvery: 25}
+	first, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("same seed gave %v and %v", first, second)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []Command
+		want     Report
+	}{
+		{
+			name: "paused commands are rejected",
+			commands: []Command{
+				{Player: 0, Words: words("spawn europe infantry")},
+				{Words: words("pause")},
+				{Player: 0, Words: words("spawn asia cavalry")},
+				{Player: 0, Words: words("move asia 1")},
+				{Player: 1, Words: words("spawn africa artillery")},
+				{Words: words("resume")},
+				{Player: 0, Words: words("move asia 1")},
+			},
+			want: Report{Steps: 7, Spawns: 1, Moves: 1, Rejected: 3},
+		},
+		{
+			// Each spawn must add a unit; a reused ID would overwrite one.
+			name: "spawned units get distinct IDs",
+			commands: []Command{
+				{Player: 0, Words: words("spawn europe infantry")},
+				{Player: 0, Words: words("spawn europe cavalry")},
+				{Player: 0, Words: words("spawn asia artillery")},
+				{Player: 1, Words: words("spawn asia infantry")},
+				{Player: 0, Words: words("spawn africa infantry")},
+			},
+			want: Report{Steps: 5, Spawns: 5},
+		},
+		{
+			// Player 0 loses unit 2, the highest, in asia; the next spawn
+			// must not be given 2 again.
+			name: "IDs of lost units are not reissued",
+			commands: []Command{
+				{Player: 0, Words: words("spawn europe infantry")},
+				{Player: 0, Words: words("spawn asia infantry")},
+				{Player: 1, Words: words("spawn africa artillery")},
+				{Player: 1, Words: words("move asia 1")},
+				{Player: 0, Words: words("spawn europe cavalry")},
+			},
+			want: Report{Steps: 5, Spawns: 4, Moves: 1, Wars: 1},
+		},
+		{
+			name: "bad commands are rejected",
+			commands: []Command{
+				{Player: 0, Words: words("spawn atlantis infantry")},
+				{Player: 0, Words: words("spawn europe dragon")},
+				{Player: 0, Words: words("move europe 9")},
+			},
+			want: Report{Steps: 3, Rejected: 3},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := RunScript(Config{Players: 2}, tc.commands)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.String() != tc.want.String() {
+				t.Errorf("got %v, want %v", report, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunScriptInvalidCommand(t *testing.T) {
+	_, err := RunScript(Config{Players: 2}, []Command{{Player: 2, Words: words("spawn europe infantry")}})
+	if err == nil {
+		t.Error("expected an error for a player that does not exist")
+	}
+}
+
+func FuzzSimulation(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 1, 0, 1, 0, 1, 1})
+	f.Add([]byte{0, 0, 3, 1, 0, 7, 0, 1, 1, 1, 1, 3})
+	f.Add([]byte{0, 0, 0, 0, 2, 0, 0, 0, 5, 0, 1, 1, 0, 3, 0, 0, 1, 1})
+	f.Add([]byte("peril fuzz seed corpus entry"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := Fuzz(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+// Package tracing sets up OpenTelemetry and carries W3C trace context in AMQP
+// headers, so one trace can follow a move from player to player and on into
+// the game log.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts every Peril span. Until Setup is called its spans are no-ops.
+var Tracer = otel.Tracer("github.com/bootdotdev/learn-pub-sub-starter")
+
+var propagator = propagation.TraceContext{}
+
+// Setup exports spans for service to exporter, which is "otlp", "stdout" or
+// empty for none. The OTLP exporter sends to localhost:4318 unless the usual
+// OTEL_EXPORTER_OTLP_ENDPOINT variables say otherwise. The returned function
+// flushes what is left; call it before exiting.
+func Setup(service, exporter string) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, use otlp or stdout", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not start %s trace exporter: %v", exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(service))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start begins a span as a child of whatever span ctx holds.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer.Start(ctx, name, opts...)
+}
+
+// headerCarrier lets the propagator read and write AMQP headers.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := []string{}
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Inject writes the span context in ctx into headers as traceparent and
+// tracestate. headers must not be nil.
+func Inject(ctx context.Context, headers amqp.Table) {
+	propagator.Inject(ctx, headerCarrier(headers))
+}
+
+// Extract returns ctx with the remote span context found in headers, if any.
+func Extract(ctx context.Context, headers amqp.Table) context.Context {
+	return propagator.Extract(ctx, headerCarrier(headers))
+}
+
+// StartEach starts a span named name under each of ctxs, for work done once
+// for messages from several traces, like writing a batch. The returned
+// function ends them all, marking them failed if err is not nil.
+func StartEach(ctxs []context.Context, name string, opts ...trace.SpanStartOption) func(err error) {
+	spans := []trace.Span{}
+	for _, ctx := range ctxs {
+		_, span := Tracer.Start(ctx, name, opts...)
+		spans = append(spans, span)
+	}
+	return func(err error) {
+		for _, span := range spans {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
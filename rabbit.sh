@@ -6,6 +6,68 @@ case "$1" in
         #docker run -d --rm --name rabbitmq -p 5672:5672 -p 15672:15672 rabbitmq:3.13-management
         docker run -d --rm --name rabbitmq -p 5672:5672 -p 15672:15672 -p 61613:61613 rabbitmq-stomp:latest
         ;;
+    start-tls)
+        if [ ! -f peril_certs/server.pem ]; then
+            echo "Run ./certs.sh init first"
+            exit 1
+        fi
+        echo "Starting RabbitMQ container with TLS on 5671..."
+        docker run -d --rm --name rabbitmq -p 5671:5671 -p 5672:5672 -p 15672:15672 -p 61613:61613 \
+            -v "$PWD/peril_certs:/etc/rabbitmq/certs:ro" \
+            -v "$PWD/rabbitmq/tls.conf:/etc/rabbitmq/conf.d/20-tls.conf:ro" \
+            rabbitmq-stomp:latest
+        ;;
+    add-user)
+        # Without a password the user can only log in with a client
+        # certificate made by "certs.sh client <username>".
+        if [ -z "$2" ]; then
+            echo "Usage: $0 add-user <username> [password]"
+            exit 1
+        fi
+        if ! [[ "$2" =~ ^[A-Za-z0-9_-]+$ ]]; then
+            echo "Usernames may only use letters, digits, '-' and '_'"
+            exit 1
+        fi
+        docker exec rabbitmq rabbitmqctl add_user "$2" "${3:-unused}"
+        if [ -z "$3" ]; then
+            docker exec rabbitmq rabbitmqctl clear_password "$2"
+        fi
+        # A player's broker user has the player's name, and may only declare
+        # and read queues named after it, plus a game's shared war queue. It
+        # may only publish logins straight to the server's queue and, on the
+        # topic exchange, messages under inbound.* for the server's relay to
+        # check. It may only bind the topic keys every player sees, and the
+        # whispers and ally chat sent to it.
+        queues="(keys|lobby|admin)\\.$2|game\\.[^.]+\\.([a-z_]+\\.$2|war|spectate\\.$2\\..+)"
+        docker exec rabbitmq rabbitmqctl set_permissions -p / "$2" \
+            "^($queues)\$" \
+            "^(amq\\.default|peril_topic|peril_dlx|$queues)\$" \
+            "^(peril_direct|peril_topic|amq\\.rabbitmq\\.reply-to|$queues)\$"
+        docker exec rabbitmq rabbitmqctl set_topic_permissions -p / "$2" peril_topic \
+            '^inbound\.' \
+            "^(keys\\.\\*|game\\.[^.]+\\.((spawn|army_moves|war|game_logs|diplomacy|wipe|presence)\\.\\*|chat\\.(say\\.\\*|(whisper|ally)\\.$2\\.\\*)))\$"
+        ;;
+    add-server)
+        # The server declares the exchanges and republishes players'
+        # messages, so it may configure, write and read everything. The
+        # gateway plays for every browser player, so it needs one too.
+        if [ -z "$2" ]; then
+            echo "Usage: $0 add-server <username> [password]"
+            exit 1
+        fi
+        docker exec rabbitmq rabbitmqctl add_user "$2" "${3:-unused}"
+        if [ -z "$3" ]; then
+            docker exec rabbitmq rabbitmqctl clear_password "$2"
+        fi
+        docker exec rabbitmq rabbitmqctl set_permissions -p / "$2" ".*" ".*" ".*"
+        ;;
+    remove-user)
+        if [ -z "$2" ]; then
+            echo "Usage: $0 remove-user <username>"
+            exit 1
+        fi
+        docker exec rabbitmq rabbitmqctl delete_user "$2"
+        ;;
     stop)
         echo "Stopping RabbitMQ container..."
         docker stop rabbitmq
@@ -15,6 +77,6 @@ case "$1" in
         docker logs -f rabbitmq
         ;;
     *)
-        echo "Usage: $0 {start|stop|logs}"
+        echo "Usage: $0 {start|start-tls|add-user|add-server|remove-user|stop|logs}"
         exit 1
 esac